@@ -1,29 +1,74 @@
 package common
 
+import (
+	"errors"
+	"time"
+)
+
+// ErrUnsupportedFileType 编辑器工厂不支持该文件类型
+var ErrUnsupportedFileType = errors.New("unsupported file type")
+
 // Editor 编辑器接口（文本编辑器、XML编辑器需实现）
 type Editor interface {
 	GetFilePath() string
+	SetFilePath(path string)
 	IsModified() bool
 	MarkAsModified(modified bool)
 	GetContent() string
+	SetContent(content string) error
+	ReloadContent(content string)
+	GetBaseContent() string
+	SetBaseContent(content string)
+	GetDiskStamp() FileStamp
+	SetDiskStamp(stamp FileStamp)
+	GetDiskState() DiskState
+	SetDiskState(state DiskState)
+	EditCount() int
+	Version() int
+	IsReadOnly() bool
+	SetReadOnly(readOnly bool)
+	IsNew() bool
+	SetNew(isNew bool)
+	HasMergeConflicts() bool
+	SetMergeConflicts(conflicts bool)
 	Undo() error
 	Redo() error
 	Show(startLine, endLine int)
-	Append(content string)
-	Insert(line, col int, text string)
-	Delete(line, col, length int)
-	Replace(line, col, length int, text string)
+	Append(content string) error
+	Insert(line, col int, text string) error
+	Delete(line, col, length int) error
+	Replace(line, col, length int, text string) error
 	SetLogEnabled(a bool)
 	IsLogEnabled() bool
 }
 
+// FileStamp 文件在磁盘上的快照信息（加载、保存时记录，用于检测外部修改）
+type FileStamp struct {
+	ModTime time.Time
+	Size    int64
+	Hash    string // 内容的 sha256（十六进制）
+}
+
+// DiskState 编辑器与磁盘文件的同步状态
+type DiskState int
+
+const (
+	DiskInSync  DiskState = iota // 与磁盘一致
+	DiskChanged                  // 磁盘上的文件已被其他程序修改
+	DiskDeleted                  // 磁盘上的文件已被删除或重命名
+)
+
 // WorkspaceEvent 工作区事件结构
+// Kind 与 Payload 为结构化信息；Type、Command 保留原有的指令名和格式化指令文本，供按文本记录的日志使用
 type WorkspaceEvent struct {
-	FilePath string 
-	Type      string      // 事件类型：指令名
-	Command   string //原始指令本身
-	Data      interface{} // 事件数据（根据类型不同而不同）
-	Timestamp int64       // 事件发生时间戳
+	FilePath   string
+	Kind       EventKind    // 事件类型
+	Payload    EventPayload // 结构化数据（具体类型见 EventKind 的说明）
+	Type       string       // 指令名（如 Insert、Save）
+	Command    string       // 格式化后的指令文本
+	Timestamp  int64        // 事件发生时间（Unix 毫秒）
+	LogEnabled bool         // 事件发生时该文件是否开启了日志（日志观察者只记录开启日志的文件）
+	Derived    bool         // 执行用户指令时产生的事件（该指令另有一条 CommandExecuted 事件，统计用户操作时不重复计数）
 }
 
 type Observer interface {
@@ -0,0 +1,130 @@
+package common
+
+import "time"
+
+// ------------------------------
+// 工作区事件的类型与结构化数据
+// ------------------------------
+
+// EventKind 事件类型（观察者按类型分支处理，无需解析 Command 字符串）
+type EventKind int
+
+const (
+	EventUnknown         EventKind = iota
+	EventFileLoaded                // 文件已加载（Payload: FilePayload）
+	EventFileClosed                // 文件已关闭（Payload: FilePayload）
+	EventEditApplied               // 编辑已生效（Payload: EditPayload）
+	EventSaved                     // 文件已保存（Payload: FilePayload）
+	EventActiveChanged             // 活动文件已切换（Payload: ActivePayload）
+	EventUndo                      // 撤销（Payload: HistoryPayload）
+	EventRedo                      // 重做（Payload: HistoryPayload）
+	EventLogToggled                // 日志开关已切换（Payload: LogToggledPayload）
+	EventRenamed                   // 另存为或重命名（Payload: RenamePayload）
+	EventShown                     // 显示文件内容（Payload: ShowPayload）
+	EventCommandExecuted           // 用户指令已执行（Payload: CommandPayload，Command 为原始输入）
+)
+
+var eventKindNames = map[EventKind]string{
+	EventUnknown:         "Unknown",
+	EventFileLoaded:      "FileLoaded",
+	EventFileClosed:      "FileClosed",
+	EventEditApplied:     "EditApplied",
+	EventSaved:           "Saved",
+	EventActiveChanged:   "ActiveChanged",
+	EventUndo:            "Undo",
+	EventRedo:            "Redo",
+	EventLogToggled:      "LogToggled",
+	EventRenamed:         "Renamed",
+	EventShown:           "Shown",
+	EventCommandExecuted: "CommandExecuted",
+}
+
+func (k EventKind) String() string {
+	if name, ok := eventKindNames[k]; ok {
+		return name
+	}
+	return "Unknown"
+}
+
+// EventPayload 事件的结构化数据，具体类型由事件的 Kind 决定
+type EventPayload interface {
+	eventPayload()
+}
+
+// EditOp 编辑操作
+type EditOp string
+
+const (
+	EditAppend  EditOp = "append"
+	EditInsert  EditOp = "insert"
+	EditDelete  EditOp = "delete"
+	EditReplace EditOp = "replace"
+)
+
+// EditPayload 编辑操作的位置、长度、文本及前后内容版本（行列号从 1 开始，未使用的为 0）
+type EditPayload struct {
+	Op         EditOp
+	Line       int
+	Col        int
+	Length     int
+	Text       string
+	OldVersion int
+	NewVersion int
+}
+
+// FilePayload 加载、保存、关闭文件时的内容版本
+type FilePayload struct {
+	Version int
+	New     bool // 尚未写入磁盘的新缓冲区
+}
+
+// ActivePayload 活动文件切换前后的路径（无活动文件时为空）
+type ActivePayload struct {
+	From string
+	To   string
+}
+
+// HistoryPayload 撤销、重做前后的内容版本
+type HistoryPayload struct {
+	OldVersion int
+	NewVersion int
+}
+
+// LogToggledPayload 日志开关的新状态及标记修改前后的内容版本
+type LogToggledPayload struct {
+	Enabled    bool
+	OldVersion int
+	NewVersion int
+}
+
+// RenamePayload 另存为、重命名前后的路径
+type RenamePayload struct {
+	From   string
+	To     string
+	SaveAs bool // true 为另存为（原文件保留），false 为重命名
+}
+
+// ShowPayload 显示的行范围（0 表示默认）
+type ShowPayload struct {
+	Start int
+	End   int
+}
+
+// CommandPayload 指令名、参数、执行结果、耗时及执行后的内容版本
+type CommandPayload struct {
+	Name     string
+	Args     []string
+	Success  bool
+	Err      string // 失败时的错误信息
+	Duration time.Duration
+	Version  int
+}
+
+func (EditPayload) eventPayload()       {}
+func (FilePayload) eventPayload()       {}
+func (ActivePayload) eventPayload()     {}
+func (HistoryPayload) eventPayload()    {}
+func (LogToggledPayload) eventPayload() {}
+func (RenamePayload) eventPayload()     {}
+func (ShowPayload) eventPayload()       {}
+func (CommandPayload) eventPayload()    {}
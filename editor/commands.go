@@ -32,16 +32,7 @@ func (cmd *AppendCommand) Execute() {
 
 	// 执行追加（新增一行）
 	cmd.editor.lines = append(cmd.editor.lines, cmd.text)
-	cmd.editor.isModified = true
 	cmd.executed = true
-
-	// 触发事件（供观察者如日志模块使用）
-	//cmd.editor.notifyEvent(Event{
-	//	Type: "append",
-	//	Data: map[string]interface{}{"text": cmd.text, "line": len(cmd.editor.lines)},
-	//	Time: time.Now().UnixMilli(),
-	//})
-
 }
 
 // 撤销：删除最后一行（恢复到追加前）
@@ -53,7 +44,6 @@ func (cmd *AppendCommand) Undo() {
 
 	// 恢复到追加前的行状态
 	cmd.editor.lines = cmd.prevLines
-	cmd.editor.isModified = true
 }
 
 func (cmd *AppendCommand) IsExecuted() bool {
@@ -126,15 +116,7 @@ func (cmd *InsertCommand) Execute() {
 		cmd.editor.lines = newLines
 	}
 
-	cmd.editor.isModified = true
 	cmd.executed = true
-
-	// 触发事件
-	//cmd.editor.notifyEvent(Event{
-	//	Type: "insert",
-	//	Data: map[string]interface{}{"line": cmd.line, "col": cmd.col, "text": cmd.text},
-	//	Time: time.Now().UnixMilli(),
-	//})
 }
 
 // 撤销：移除插入的内容（恢复到插入前）
@@ -158,8 +140,6 @@ func (cmd *InsertCommand) Undo() {
 		newLines = append(newLines, cmd.editor.lines[lineIdx+1+removeCount:]...) // 跳过插入的中间行
 		cmd.editor.lines = newLines
 	}
-
-	cmd.editor.isModified = true
 }
 
 // 验证插入位置是否合法
@@ -226,15 +206,7 @@ func (cmd *DeleteCommand) Execute() {
 	newLine := currentLine[:colIdx] + currentLine[colIdx+cmd.length:]
 	cmd.editor.lines[lineIdx] = newLine
 
-	cmd.editor.isModified = true
 	cmd.executed = true
-
-	// 触发事件
-	//cmd.editor.notifyEvent(Event{
-	//	Type: "delete",
-	//	Data: map[string]interface{}{"line": cmd.line, "col": cmd.col, "length": cmd.length},
-	//	Time: time.Now().UnixMilli(),
-	//})
 }
 
 // 撤销：恢复被删除的字符
@@ -246,7 +218,6 @@ func (cmd *DeleteCommand) Undo() {
 
 	// 恢复原行内容
 	cmd.editor.lines[cmd.line-1] = cmd.prevLine
-	cmd.editor.isModified = true
 }
 
 // 验证删除范围是否合法
@@ -322,13 +293,6 @@ func (cmd *ReplaceCommand) Execute() {
 	// 再执行插入（删除后行结构可能变化，但插入位置仍基于原行号）
 	cmd.insertCmd.Execute()
 	cmd.executed = cmd.insertCmd.IsExecuted()
-
-	//// 触发事件
-	//cmd.editor.notifyEvent(Event{
-	//	Type: "replace",
-	//	Data: map[string]interface{}{"line": cmd.line, "col": cmd.col, "length": cmd.length, "text": cmd.text},
-	//	Time: time.Now().UnixMilli(),
-	//})
 }
 
 // 撤销：先撤销插入，再撤销删除（恢复原状态）
@@ -342,10 +306,125 @@ func (cmd *ReplaceCommand) Undo() {
 	cmd.insertCmd.Undo()
 	// 再撤销删除（恢复原文本）
 	cmd.deleteCmd.Undo()
-
-	cmd.editor.isModified = true
 }
 
 func (cmd *ReplaceCommand) IsExecuted() bool {
 	return cmd.executed
 }
+
+// ------------------------------
+// 6. SetContentCommand：整体替换缓冲区内容（合并、解决冲突等）
+// ------------------------------
+
+type SetContentCommand struct {
+	editor      *TextEditor // 关联的编辑器
+	newLines    []string    // 替换后的所有行
+	prevLines   []string    // 替换前的所有行（用于撤销）
+	prevEnabled bool        // 替换前的日志开关（用于撤销）
+	executed    bool        // 是否执行成功
+}
+
+func NewSetContentCommand(editor *TextEditor, content string) *SetContentCommand {
+	return &SetContentCommand{
+		editor:   editor,
+		newLines: strings.Split(content, "\n"),
+	}
+}
+
+// 执行：保存当前所有行后整体替换
+
+func (cmd *SetContentCommand) Execute() {
+	if cmd.editor == nil {
+		return
+	}
+
+	cmd.prevLines = make([]string, len(cmd.editor.lines))
+	copy(cmd.prevLines, cmd.editor.lines)
+
+	cmd.prevEnabled = cmd.editor.logEnabled
+
+	cmd.editor.lines = make([]string, len(cmd.newLines))
+	copy(cmd.editor.lines, cmd.newLines)
+	// 日志开关与新内容首行的 # log 标记保持一致
+	cmd.editor.logEnabled = hasLogMarker(cmd.editor.lines)
+	cmd.executed = true
+}
+
+// 撤销：恢复替换前的所有行
+
+func (cmd *SetContentCommand) Undo() {
+	if !cmd.executed || cmd.editor == nil {
+		return
+	}
+
+	cmd.editor.lines = cmd.prevLines
+	cmd.editor.logEnabled = cmd.prevEnabled
+}
+
+func (cmd *SetContentCommand) IsExecuted() bool {
+	return cmd.executed
+}
+
+// ------------------------------
+// 7. LogMarkerCommand：处理 "log-on"/"log-off" 命令（添加或移除首行的 # log 标记）
+// ------------------------------
+
+type LogMarkerCommand struct {
+	editor      *TextEditor // 关联的编辑器
+	enable      bool        // true 添加标记，false 移除标记
+	prevLines   []string    // 修改前的所有行（用于撤销）
+	prevEnabled bool        // 修改前的日志开关（用于撤销）
+	executed    bool        // 是否执行成功
+}
+
+func NewLogMarkerCommand(editor *TextEditor, enable bool) *LogMarkerCommand {
+	return &LogMarkerCommand{
+		editor: editor,
+		enable: enable,
+	}
+}
+
+// 执行：开启时在首行前插入 # log，关闭时删除首行的 # log，并同步日志开关
+
+func (cmd *LogMarkerCommand) Execute() {
+	if cmd.editor == nil || hasLogMarker(cmd.editor.lines) == cmd.enable {
+		return
+	}
+
+	cmd.prevLines = make([]string, len(cmd.editor.lines))
+	copy(cmd.prevLines, cmd.editor.lines)
+	cmd.prevEnabled = cmd.editor.logEnabled
+
+	if cmd.enable {
+		if len(cmd.editor.lines) == 1 && cmd.editor.lines[0] == "" {
+			// 空文件：标记即为唯一的一行
+			cmd.editor.lines = []string{"# log"}
+		} else {
+			cmd.editor.lines = append([]string{"# log"}, cmd.editor.lines...)
+		}
+	} else {
+		cmd.editor.lines = append([]string(nil), cmd.editor.lines[1:]...)
+	}
+	cmd.editor.logEnabled = cmd.enable
+	cmd.executed = true
+}
+
+// 撤销：恢复修改前的所有行和日志开关
+
+func (cmd *LogMarkerCommand) Undo() {
+	if !cmd.executed || cmd.editor == nil {
+		return
+	}
+
+	cmd.editor.lines = cmd.prevLines
+	cmd.editor.logEnabled = cmd.prevEnabled
+}
+
+func (cmd *LogMarkerCommand) IsExecuted() bool {
+	return cmd.executed
+}
+
+// hasLogMarker 首行是否为 # log 标记
+func hasLogMarker(lines []string) bool {
+	return len(lines) > 0 && strings.TrimSpace(lines[0]) == "# log"
+}
@@ -1,6 +1,7 @@
 package editor
 
 import (
+	"errors"
 	"fmt"
 	"lab1/common"
 	"strings"
@@ -17,69 +18,104 @@ func NewAppendCommand(editor *TextEditor, text string) *AppendCommand {
 
 // 暴露给外部的操作方法（供用户指令调用）
 
-func (te *TextEditor) Append(text string) {
-	if te.logEnabled{
-	te.workspaceApi.NotifyObservers(common.WorkspaceEvent{
-		FilePath: te.GetFilePath(),
-		Type: "Append",
-		Command: "Append " + text,
-		Timestamp: time.Now().UnixMilli(),
-	})		
+// ErrReadOnly 文件以只读方式打开，拒绝编辑
+var ErrReadOnly = errors.New("文件以只读方式打开，无法编辑")
+
+// ErrOutOfRange 编辑位置或长度超出文件范围
+var ErrOutOfRange = errors.New("位置或长度超出文件范围")
+
+// checkWritable 只读打开的文件拒绝编辑
+func (te *TextEditor) checkWritable() error {
+	if te.readOnly {
+		return ErrReadOnly
 	}
+	return nil
+}
 
-	te.ExecuteCommand(NewAppendCommand(te, text))
+func (te *TextEditor) Append(text string) error {
+	if err := te.checkWritable(); err != nil {
+		return err
+	}
+	return te.applyEdit(NewAppendCommand(te, text), "Append", "Append "+text,
+		common.EditPayload{Op: common.EditAppend, Line: len(te.lines) + 1, Text: text})
 }
 
-func (te *TextEditor) Insert(line, col int, text string) {
-	if te.logEnabled{
+func (te *TextEditor) Insert(line, col int, text string) error {
+	if err := te.checkWritable(); err != nil {
+		return err
+	}
 	commandStr := "Insert " + strconv.Itoa(line) + "," + strconv.Itoa(col) + " " + text
-	te.workspaceApi.NotifyObservers(common.WorkspaceEvent{
-		FilePath: te.GetFilePath(),
-		Type:     "Insert",
-		Command:  commandStr,
-		Timestamp: time.Now().UnixMilli(),
-	})
+	return te.applyEdit(NewInsertCommand(te, line, col, text), "Insert", commandStr,
+		common.EditPayload{Op: common.EditInsert, Line: line, Col: col, Text: text})
+}
+
+func (te *TextEditor) Delete(line, col, length int) error {
+	if err := te.checkWritable(); err != nil {
+		return err
 	}
-	te.ExecuteCommand(NewInsertCommand(te, line, col, text))
+	commandStr := "Delete " + strconv.Itoa(line) + "," + strconv.Itoa(col) + "," + strconv.Itoa(length)
+	return te.applyEdit(NewDeleteCommand(te, line, col, length), "Delete", commandStr,
+		common.EditPayload{Op: common.EditDelete, Line: line, Col: col, Length: length})
 }
 
-func (te *TextEditor) Delete(line, col, length int) {
-	if te.logEnabled{
-	commandStr := "Delete "+ strconv.Itoa(line)+","+strconv.Itoa(col)+","+strconv.Itoa(length)
-	te.workspaceApi.NotifyObservers(common.WorkspaceEvent{
-		FilePath: te.GetFilePath(),
-		Type: "Delete",
-		Command: commandStr,
-		Timestamp: time.Now().UnixMilli(),
-	})
+func (te *TextEditor) Replace(line, col, length int, text string) error {
+	if err := te.checkWritable(); err != nil {
+		return err
 	}
-	te.ExecuteCommand(NewDeleteCommand(te, line, col, length))
+	commandStr := "Replace " + strconv.Itoa(line) + "," + strconv.Itoa(col) + "," + strconv.Itoa(length) + " " + text
+	return te.applyEdit(NewReplaceCommand(te, line, col, length, text), "Replace", commandStr,
+		common.EditPayload{Op: common.EditReplace, Line: line, Col: col, Length: length, Text: text})
 }
 
-func (te *TextEditor) Replace(line, col, length int, text string) {
-	if te.logEnabled{
-	commandStr := "Replace "+ strconv.Itoa(line)+","+strconv.Itoa(col)+","+strconv.Itoa(length)+" "+text
+// applyEdit 执行编辑命令，生效后通知观察者，事件中带有编辑前后的内容版本
+// 位置或长度不合法时命令不生效，返回 ErrOutOfRange
+func (te *TextEditor) applyEdit(command Command, eventType, commandStr string, payload common.EditPayload) error {
+	payload.OldVersion = te.version
+	te.ExecuteCommand(command)
+	if !command.IsExecuted() {
+		return ErrOutOfRange
+	}
+	payload.NewVersion = te.version
+	te.notifyEvent(common.EventEditApplied, eventType, commandStr, payload)
+	return nil
+}
+
+// notifyEvent 通知观察者，事件中记录当前的日志开关（日志开关切换本身总是标记为开启，开关的时间点会被记录）
+func (te *TextEditor) notifyEvent(kind common.EventKind, eventType, commandStr string, payload common.EventPayload) {
+	if te.workspaceApi == nil {
+		return
+	}
 	te.workspaceApi.NotifyObservers(common.WorkspaceEvent{
-		FilePath: te.GetFilePath(),
-		Type: "Relpace",
-		Command: commandStr,
-		Timestamp: time.Now().UnixMilli(),
+		FilePath:   te.GetFilePath(),
+		Kind:       kind,
+		Payload:    payload,
+		Type:       eventType,
+		Command:    commandStr,
+		Timestamp:  time.Now().UnixMilli(),
+		LogEnabled: te.logEnabled || kind == common.EventLogToggled,
 	})
+}
+
+// SetContent 整体替换缓冲区内容（可撤销）；只读打开的文件返回 ErrReadOnly
+func (te *TextEditor) SetContent(content string) error {
+	if err := te.checkWritable(); err != nil {
+		return err
 	}
-	te.ExecuteCommand(NewReplaceCommand(te, line, col, length, text))
+	te.ExecuteCommand(NewSetContentCommand(te, content))
+	return nil
+}
+
+// ReloadContent 用磁盘上的内容整体替换缓冲区（可撤销）并记为已保存
+// 与磁盘同步不是用户编辑，只读打开的文件同样可以重新加载
+func (te *TextEditor) ReloadContent(content string) {
+	te.ExecuteCommand(NewSetContentCommand(te, content))
+	te.MarkAsModified(false)
 }
 
 // Show 方法
 func (te *TextEditor) Show(startLine, endLine int) {
-	if te.logEnabled{
-	commandStr := "Show "+ strconv.Itoa(startLine)+","+strconv.Itoa(endLine)
-	te.workspaceApi.NotifyObservers(common.WorkspaceEvent{
-		FilePath: te.GetFilePath(),
-		Type: "Show",
-		Command: commandStr,
-		Timestamp: time.Now().UnixMilli(),
-	})
-	}
+	commandStr := "Show " + strconv.Itoa(startLine) + "," + strconv.Itoa(endLine)
+	te.notifyEvent(common.EventShown, "Show", commandStr, common.ShowPayload{Start: startLine, End: endLine})
 
 	lineCount := len(te.lines)
 
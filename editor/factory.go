@@ -1,7 +1,6 @@
 package editor
 
 import (
-	"errors"
 	"fmt"
 	"lab1/common"
 	"os"
@@ -71,19 +70,17 @@ import (
 // }
 
 func EditorFactory(path string, wsApi common.WorkSpaceApi) (common.Editor, error) {
-	isNewFile := false
+	ext := strings.ToLower(filepath.Ext(path))
+	if ext != ".txt" {
+		return nil, fmt.Errorf("%w: %s", common.ErrUnsupportedFileType, ext)
+	}
 
 	if _, err := os.Stat(path); err != nil {
 		if os.IsNotExist(err) {
-			// 新建空文件（权限 0644：所有者可读写，其他用户可读）
-			if err := os.WriteFile(path, []byte(""), 0644); err != nil {
-				return nil, fmt.Errorf("failed to create file: %w", err)
-			}
-			isNewFile = true // 标记为新创建的文件
-		} else {
-			
-			return nil, fmt.Errorf("failed to check file status: %w", err)
+			// 文件不存在：只在内存中创建新缓冲区（已修改、日志默认关闭），save 时才写入磁盘
+			return BufferFactory(path, "", wsApi)
 		}
+		return nil, fmt.Errorf("failed to check file status: %w", err)
 	}
 
 	content, err := os.ReadFile(path)
@@ -91,31 +88,27 @@ func EditorFactory(path string, wsApi common.WorkSpaceApi) (common.Editor, error
 		return nil, fmt.Errorf("failed to read file: %w", err)
 	}
 
-	ext := strings.ToLower(filepath.Ext(path))
 	switch ext {
 	case ".txt":
 		editor := NewTextEditor(path, string(content),wsApi)
-		// 若为新创建的文件，标记为已修改且日志默认关闭
-		if isNewFile {
-			editor.MarkAsModified(true)
-			editor.SetLogEnabled(false) 
-		} else {
-			// 现有文件检查首行是否有# log标记
-			firstLine := ""
-			lines := strings.Split(string(content), "\n")
-			if len(lines) > 0 {
-				firstLine = strings.TrimSpace(lines[0])
-			}
-			
-			logEnabled := strings.Contains(firstLine, "# log")
-			editor.SetLogEnabled(logEnabled)
-		}
+		// 现有文件检查首行是否有# log标记（只读取，不修改内容）
+		editor.logEnabled = hasLogMarker(editor.lines)
 		return editor, nil
 	default:
-		return nil, errors.New("unsupported file type: " + ext)
+		return nil, fmt.Errorf("%w: %s", common.ErrUnsupportedFileType, ext)
 	}
 }
 
+// BufferFactory 在内存中创建未写入磁盘的新缓冲区编辑器（用于 init、加载不存在的文件及恢复从未保存的缓冲区，不触碰磁盘）
+func BufferFactory(path, content string, wsApi common.WorkSpaceApi) (common.Editor, error) {
+	editor := NewTextEditor(path, content, wsApi)
+	editor.SetNew(true)
+	// 从未保存过，没有磁盘基准内容
+	editor.SetBaseContent("")
+	editor.logEnabled = hasLogMarker(editor.lines)
+	editor.MarkAsModified(true)
+	return editor, nil
+}
 
 /*
 新增逻辑，打开的时候，先检查首行# log标志，如果是新建的，那么默认lon为false
@@ -1,6 +1,7 @@
 package editor
 
 import (
+	"errors"
 	"fmt"
 	"strings"
 	"lab1/common"
@@ -10,14 +11,33 @@ import (
 type TextEditor struct {
 	filePath   string
 	lines      []string
-	isModified bool
-	undoStack  []Command
-	redoStack  []Command
+	undoStack  []historyEntry
+	redoStack  []historyEntry
+	version      int // 当前内容的版本号，每次执行命令分配新的版本号，撤销、重做时回到对应版本
+	nextVersion  int // 下一个可分配的版本号（单调递增，撤销后再编辑也不会与已有版本重复）
+	savedVersion int // 上次保存（或加载）时的版本号，unsavedVersion 表示与任何版本都不一致
 	logEnabled bool
+	baseContent string // 加载或上次保存时磁盘上的内容（三方合并的共同祖先）
+	diskStamp  common.FileStamp // 加载或上次保存时的磁盘快照
+	diskState  common.DiskState // 与磁盘文件的同步状态
+	editCount  int              // 累计编辑次数（执行、撤销、重做均计数，用于自动保存）
+	readOnly   bool             // 文件被其他实例锁定时以只读方式打开
+	isNew      bool             // 新建的缓冲区，尚未写入磁盘
+	mergeConflicts bool         // 与磁盘合并时插入了冲突标记，解决前不允许保存
 	workspaceApi common.WorkSpaceApi
 	//observers  []workspace.Observer // 观察者列表（可选，用于编辑器级事件）
 }
 
+// unsavedVersion 不与任何内容版本相同的保存版本号（新缓冲区、恢复出的未保存内容）
+const unsavedVersion = -1
+
+// historyEntry 撤销/重做历史中的一条记录：命令及其执行前后的内容版本
+type historyEntry struct {
+	cmd    Command
+	before int
+	after  int
+}
+
 // RegisterObsever()
 
 
@@ -27,61 +47,24 @@ type TextEditor struct {
 func (t *TextEditor) IsLogEnabled() bool {
     return t.logEnabled
 }
-// //这里要加上对文件首行的更新
-// func (t *TextEditor) SetLogEnabled(enabled bool) {
-//     t.logEnabled = enabled
-// 	if enabled{
-
-// 	}else{
-
-// 	}
-// }
-// SetLogEnabled 设置日志开关，并在内存中更新文件首行的# log标记（不直接持久化到磁盘）
+// SetLogEnabled 开启或关闭日志，并在内存中添加或移除文件首行的# log标记（不直接持久化到磁盘）
+// 标记的修改作为可撤销的命令执行；首行已与开关一致时只更新开关，不修改内容
 func (t *TextEditor) SetLogEnabled(enabled bool) {
-	// 1. 记录旧状态，若状态无变化则直接返回，避免无效操作
-	oldEnabled := t.logEnabled
-	t.logEnabled = enabled
-	if oldEnabled == enabled {
+	oldEnabled, oldVersion := t.logEnabled, t.version
+	if hasLogMarker(t.lines) == enabled {
+		t.logEnabled = enabled
+	} else if t.readOnly {
+		fmt.Printf("文件 %s 以只读方式打开，无法修改日志标记\n", t.filePath)
 		return
-	}
-
-	// 2. 根据开关状态，在内存中处理首行的# log标记
-	if enabled {
-		// 开启日志：首行无# log则插入（仅内存中）
-		t.addLogMarkerInMemory()
-	} else {
-		// 关闭日志：首行有# log则移除（仅内存中）
-		t.removeLogMarkerInMemory()
-	}
-}
-
-// addLogMarkerInMemory 仅在内存中给文件首行添加# log标记（无则加）
-func (t *TextEditor) addLogMarkerInMemory() {
-	if len(t.lines) == 0 {
-		t.lines = []string{"# log"}
 	} else {
-		
-		firstLine := strings.TrimSpace(t.lines[0])
-		if firstLine != "# log" {
-			
-			t.lines = append([]string{"# log"}, t.lines...)
-		}
-	}
-	// 标记文件为已修改（供后续持久化逻辑判断）
-	t.MarkAsModified(true)
-}
-
-// removeLogMarkerInMemory 仅在内存中移除文件首行的# log标记（有则删）
-func (t *TextEditor) removeLogMarkerInMemory() {
-	if len(t.lines) == 0 {
-		return 
+		t.ExecuteCommand(NewLogMarkerCommand(t, enabled))
 	}
 
-	// 去除首行空格后检查是否是目标标记
-	firstLine := strings.TrimSpace(t.lines[0])
-	if firstLine == "# log" {
-		t.lines = t.lines[1:]
-		t.MarkAsModified(true)
+	// 开启和关闭都通知观察者，日志中可以看到开关的时间点
+	if oldEnabled != t.logEnabled {
+		eventType := map[bool]string{true: "LogOn", false: "LogOff"}[t.logEnabled]
+		t.notifyEvent(common.EventLogToggled, eventType, eventType,
+			common.LogToggledPayload{Enabled: t.logEnabled, OldVersion: oldVersion, NewVersion: t.version})
 	}
 }
 
@@ -90,6 +73,8 @@ func NewTextEditor(filePath, content string,wsApi common.WorkSpaceApi) *TextEdit
 	return &TextEditor{
 		filePath: filePath,
 		lines:    strings.Split(content, "\n"),
+		baseContent: content,
+		nextVersion: 1,
 		workspaceApi: wsApi,
 		//observers: make([]workspace.Observer, 0),
 	}
@@ -100,46 +85,139 @@ func (te *TextEditor) GetFilePath() string {
 	return te.filePath
 }
 
-// IsModified 检查是否修改
+// SetFilePath 修改文件路径（另存为、重命名），撤销历史保持不变
+func (te *TextEditor) SetFilePath(path string) {
+	te.filePath = path
+}
+
+// IsModified 检查是否修改：当前内容版本与上次保存时的版本不同即为已修改
+// 撤销、重做回到保存时的版本后恢复为未修改
 func (te *TextEditor) IsModified() bool {
-	return te.isModified
+	return te.version != te.savedVersion
 }
 
-// MarkAsModified 标记修改状态
+// MarkAsModified 标记修改状态：false 将当前版本记为已保存，true 使当前内容与任何版本都视为未保存
 func (te *TextEditor) MarkAsModified(modified bool) {
-	te.isModified = modified
+	if modified {
+		te.savedVersion = unsavedVersion
+	} else {
+		te.savedVersion = te.version
+	}
+}
+
+// Version 当前内容的版本号
+func (te *TextEditor) Version() int {
+	return te.version
+}
+
+// GetBaseContent 获取加载或上次保存时的磁盘内容
+func (te *TextEditor) GetBaseContent() string {
+	return te.baseContent
+}
+
+// SetBaseContent 更新合并基准内容（保存成功或与磁盘合并后调用）
+func (te *TextEditor) SetBaseContent(content string) {
+	te.baseContent = content
+}
+
+// GetDiskStamp 获取加载或上次保存时记录的磁盘快照
+func (te *TextEditor) GetDiskStamp() common.FileStamp {
+	return te.diskStamp
+}
+
+// SetDiskStamp 记录磁盘快照
+func (te *TextEditor) SetDiskStamp(stamp common.FileStamp) {
+	te.diskStamp = stamp
+}
+
+// GetDiskState 获取与磁盘文件的同步状态
+func (te *TextEditor) GetDiskState() common.DiskState {
+	return te.diskState
+}
+
+// SetDiskState 设置与磁盘文件的同步状态
+func (te *TextEditor) SetDiskState(state common.DiskState) {
+	te.diskState = state
+}
+
+// IsReadOnly 是否以只读方式打开
+func (te *TextEditor) IsReadOnly() bool {
+	return te.readOnly
+}
+
+// SetReadOnly 设置只读状态
+func (te *TextEditor) SetReadOnly(readOnly bool) {
+	te.readOnly = readOnly
+}
+
+// IsNew 是否为尚未写入磁盘的新缓冲区
+func (te *TextEditor) IsNew() bool {
+	return te.isNew
+}
+
+// SetNew 设置是否为新缓冲区（首次保存后清除）
+func (te *TextEditor) SetNew(isNew bool) {
+	te.isNew = isNew
+}
+
+// HasMergeConflicts 是否有与磁盘合并时插入的冲突标记尚未确认解决
+func (te *TextEditor) HasMergeConflicts() bool {
+	return te.mergeConflicts
+}
+
+// SetMergeConflicts 记录合并是否插入了冲突标记
+func (te *TextEditor) SetMergeConflicts(conflicts bool) {
+	te.mergeConflicts = conflicts
+}
+
+// EditCount 获取累计编辑次数
+func (te *TextEditor) EditCount() int {
+	return te.editCount
 }
 
 // ExecuteCommand 执行命令（命令模式入口）
+// 执行失败（位置不合法等）的命令不记入撤销历史
 func (te *TextEditor) ExecuteCommand(command Command) {
 	command.Execute()
-	te.undoStack = append(te.undoStack, command)
+	if !command.IsExecuted() {
+		return
+	}
+	// 执行成功的命令产生新的内容版本
+	entry := historyEntry{cmd: command, before: te.version, after: te.nextVersion}
+	te.nextVersion++
+	te.version = entry.after
+	te.undoStack = append(te.undoStack, entry)
 	te.redoStack = nil // 新操作清空重做栈
-	te.isModified = true
+	te.editCount++
 }
 
 // Undo 撤销操作
 func (te *TextEditor) Undo() error {
 	if len(te.undoStack) == 0 {
-		return nil
+		return errors.New("没有可撤销的操作")
 	}
-	cmd := te.undoStack[len(te.undoStack)-1]
-	cmd.Undo()
+	entry := te.undoStack[len(te.undoStack)-1]
+	entry.cmd.Undo()
+	te.version = entry.before
 	te.undoStack = te.undoStack[:len(te.undoStack)-1]
-	te.redoStack = append(te.redoStack, cmd)
+	te.redoStack = append(te.redoStack, entry)
+	te.editCount++
+	te.notifyEvent(common.EventUndo, "Undo", "Undo", common.HistoryPayload{OldVersion: entry.after, NewVersion: entry.before})
 	return nil
 }
 
 // Redo 重做操作
 func (te *TextEditor) Redo() error {
 	if len(te.redoStack) == 0 {
-		fmt.Println("redo stack is empty!")
-		return nil
+		return errors.New("没有可重做的操作")
 	}
-	cmd := te.redoStack[len(te.redoStack)-1]
-	cmd.Execute()
+	entry := te.redoStack[len(te.redoStack)-1]
+	entry.cmd.Execute()
+	te.version = entry.after
 	te.redoStack = te.redoStack[:len(te.redoStack)-1]
-	te.undoStack = append(te.undoStack, cmd)
+	te.undoStack = append(te.undoStack, entry)
+	te.editCount++
+	te.notifyEvent(common.EventRedo, "Redo", "Redo", common.HistoryPayload{OldVersion: entry.before, NewVersion: entry.after})
 	return nil
 }
 
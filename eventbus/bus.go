@@ -0,0 +1,310 @@
+package eventbus
+
+import (
+	"fmt"
+	"lab1/common"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// ------------------------------
+// 异步事件总线：每个订阅者有独立的缓冲队列和投递协程
+// ------------------------------
+//
+// 发布事件只是写入各订阅者的队列，观察者在自己的协程中处理：处理慢的观察者不会拖慢其他观察者，
+// panic 会被恢复并报告，不会导致编辑器崩溃。Flush 等待所有已发布的事件处理完毕，Close 在退出前调用。
+// 工作区会在持有自身锁时发布事件和调用 Flush，因此观察者的 Update 中不能获取工作区的锁，否则会死锁。
+
+// Policy 订阅者队列已满时的处理方式
+type Policy int
+
+const (
+	Block      Policy = iota // 等待队列有空位（背压，事件不丢失，默认）
+	DropNewest               // 丢弃新事件并计数
+)
+
+// Filter 订阅过滤条件，为空的条件不做限制
+type Filter struct {
+	Kinds []common.EventKind // 只接收这些类型的事件
+	Glob  string             // 只接收文件路径匹配的事件；不含路径分隔符时匹配文件名（如 *.txt）
+	Log   bool               // 只接收开启了日志的文件的事件（日志观察者使用）
+}
+
+// Match 事件是否满足过滤条件
+func (f Filter) Match(event common.WorkspaceEvent) bool {
+	if f.Log && !event.LogEnabled {
+		return false
+	}
+	if len(f.Kinds) > 0 {
+		found := false
+		for _, kind := range f.Kinds {
+			if kind == event.Kind {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	if f.Glob != "" {
+		name := filepath.ToSlash(event.FilePath)
+		if !strings.Contains(f.Glob, "/") {
+			name = filepath.Base(event.FilePath)
+		}
+		if ok, err := filepath.Match(f.Glob, name); err != nil || !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// Options 订阅选项
+type Options struct {
+	Name   string // 报告错误时显示的名称，默认为观察者的类型名
+	Buffer int    // 队列长度，默认 DefaultBuffer
+	Policy Policy
+	Filter Filter
+}
+
+// DefaultBuffer 默认的订阅者队列长度
+const DefaultBuffer = 256
+
+// Subscription 订阅句柄，用于取消订阅和查询丢弃的事件数
+type Subscription struct {
+	id       uint64
+	name     string
+	bus      *Bus
+	observer common.Observer
+	opts     Options
+	queue    chan common.WorkspaceEvent
+	sendMu   sync.RWMutex // 发布（读锁）与关闭队列（写锁）互斥，避免向已关闭的队列发送
+	closed   bool         // 队列已关闭（受 sendMu 保护）
+	mu       sync.Mutex
+	idle     *sync.Cond    // 队列中的事件全部处理完时广播
+	pending  int           // 已入队但尚未处理完的事件数
+	done     chan struct{} // 投递协程已退出
+	dropped  atomic.Int64
+	once     sync.Once
+}
+
+// Name 订阅者名称
+func (s *Subscription) Name() string {
+	return s.name
+}
+
+// Dropped 因队列已满而丢弃的事件数
+func (s *Subscription) Dropped() int64 {
+	return s.dropped.Load()
+}
+
+// Unsubscribe 取消订阅：不再接收新事件，已入队的事件处理完后返回（不能在观察者的 Update 中调用）
+func (s *Subscription) Unsubscribe() {
+	s.once.Do(func() {
+		s.bus.mu.Lock()
+		delete(s.bus.subs, s.id)
+		s.bus.mu.Unlock()
+		s.sendMu.Lock()
+		s.closed = true
+		close(s.queue)
+		s.sendMu.Unlock()
+		<-s.done
+	})
+}
+
+// run 投递协程：逐个处理队列中的事件
+func (s *Subscription) run() {
+	defer close(s.done)
+	for event := range s.queue {
+		s.deliver(event)
+	}
+}
+
+// begin 记录一个入队的事件
+func (s *Subscription) begin() {
+	s.mu.Lock()
+	s.pending++
+	s.mu.Unlock()
+}
+
+// finish 记录一个事件处理完毕
+func (s *Subscription) finish() {
+	s.mu.Lock()
+	s.pending--
+	if s.pending == 0 {
+		s.idle.Broadcast()
+	}
+	s.mu.Unlock()
+}
+
+// wait 等待队列中的事件全部处理完毕
+func (s *Subscription) wait() {
+	s.mu.Lock()
+	for s.pending > 0 {
+		s.idle.Wait()
+	}
+	s.mu.Unlock()
+}
+
+// deliver 调用观察者处理单个事件，恢复 panic 并报告
+func (s *Subscription) deliver(event common.WorkspaceEvent) {
+	defer s.finish()
+	defer func() {
+		if r := recover(); r != nil {
+			s.bus.report(fmt.Errorf("观察者 %s 处理 %s 事件时 panic: %v", s.name, event.Kind, r))
+		}
+	}()
+	s.observer.Update(event)
+}
+
+// Bus 事件总线
+type Bus struct {
+	mu     sync.RWMutex
+	subs   map[uint64]*Subscription
+	nextID uint64
+	closed bool
+	report func(err error)
+}
+
+// New 创建事件总线，report 用于报告观察者的 panic 等错误（为 nil 时打印到标准输出）
+func New(report func(err error)) *Bus {
+	if report == nil {
+		report = func(err error) { fmt.Printf("警告：%v\n", err) }
+	}
+	return &Bus{
+		subs:   make(map[uint64]*Subscription),
+		report: report,
+	}
+}
+
+// Subscribe 订阅事件，返回的句柄用于取消订阅
+func (b *Bus) Subscribe(observer common.Observer, opts Options) *Subscription {
+	if opts.Buffer <= 0 {
+		opts.Buffer = DefaultBuffer
+	}
+	name := opts.Name
+	if name == "" {
+		name = fmt.Sprintf("%T", observer)
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.nextID++
+	sub := &Subscription{
+		id:       b.nextID,
+		name:     name,
+		bus:      b,
+		observer: observer,
+		opts:     opts,
+		queue:    make(chan common.WorkspaceEvent, opts.Buffer),
+		done:     make(chan struct{}),
+	}
+	sub.idle = sync.NewCond(&sub.mu)
+	if b.closed {
+		// 总线已关闭：返回不接收事件的句柄
+		sub.once.Do(func() { sub.closed = true; close(sub.queue); close(sub.done) })
+		return sub
+	}
+	b.subs[sub.id] = sub
+	go sub.run()
+	return sub
+}
+
+// Publish 将事件放入所有匹配的订阅者队列（同一订阅者按发布顺序处理，不同订阅者之间不保证先后）
+// 在总线的锁内取得订阅者快照，在锁外入队：等待某个已满的队列时不影响订阅、取消订阅和其他总线操作
+func (b *Bus) Publish(event common.WorkspaceEvent) {
+	b.mu.RLock()
+	if b.closed {
+		b.mu.RUnlock()
+		return
+	}
+	subs := make([]*Subscription, 0, len(b.subs))
+	for _, sub := range b.subs {
+		if sub.opts.Filter.Match(event) {
+			subs = append(subs, sub)
+		}
+	}
+	b.mu.RUnlock()
+
+	for _, sub := range subs {
+		sub.send(event)
+	}
+}
+
+// send 将事件放入队列；队列已关闭（取消订阅）时忽略，队列已满时按策略等待或丢弃
+func (s *Subscription) send(event common.WorkspaceEvent) {
+	s.sendMu.RLock()
+	defer s.sendMu.RUnlock()
+	if s.closed {
+		return
+	}
+	s.begin()
+	if s.opts.Policy == DropNewest {
+		select {
+		case s.queue <- event:
+		default:
+			s.finish()
+			if s.dropped.Add(1) == 1 {
+				s.bus.report(fmt.Errorf("观察者 %s 处理过慢，队列已满，开始丢弃事件", s.name))
+			}
+		}
+		return
+	}
+	s.queue <- event
+}
+
+// Flush 等待已发布的事件全部处理完毕（log-show 读取日志前、退出前调用）
+func (b *Bus) Flush() {
+	b.mu.RLock()
+	subs := make([]*Subscription, 0, len(b.subs))
+	for _, sub := range b.subs {
+		subs = append(subs, sub)
+	}
+	b.mu.RUnlock()
+	for _, sub := range subs {
+		sub.wait()
+	}
+}
+
+// Close 停止接收新事件，等待已入队的事件处理完毕后结束所有投递协程，返回各订阅者及其丢弃的事件数
+func (b *Bus) Close() map[string]int64 {
+	b.mu.Lock()
+	if b.closed {
+		b.mu.Unlock()
+		return nil
+	}
+	b.closed = true
+	subs := make([]*Subscription, 0, len(b.subs))
+	for _, sub := range b.subs {
+		subs = append(subs, sub)
+	}
+	b.mu.Unlock()
+
+	dropped := make(map[string]int64)
+	for _, sub := range subs {
+		sub.Unsubscribe()
+		if n := sub.Dropped(); n > 0 {
+			dropped[sub.name] += n
+		}
+	}
+	return dropped
+}
+
+// Observers 当前订阅的观察者（按订阅先后）
+func (b *Bus) Observers() []common.Observer {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	subs := make([]*Subscription, 0, len(b.subs))
+	for _, sub := range b.subs {
+		subs = append(subs, sub)
+	}
+	sort.Slice(subs, func(i, j int) bool { return subs[i].id < subs[j].id })
+	observers := make([]common.Observer, len(subs))
+	for i, sub := range subs {
+		observers[i] = sub.observer
+	}
+	return observers
+}
@@ -0,0 +1,283 @@
+package jsonlog
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"lab1/common"
+	"lab1/logpath"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ------------------------------
+// 结构化日志：JSON Lines 格式，每个事件一行，便于统计分析
+// ------------------------------
+//
+// 与文本日志并列存放（.apple.txt.log 旁的 .apple.txt.jsonl），路径由 logpath 决定，轮转由工作区在加锁时进行。
+// 每次启动生成一个会话 ID，首次写入某个文件时先写一条 SessionStart 记录。
+
+// Format 日志格式：文本、JSONL 或两者同时写入
+type Format int
+
+const (
+	FormatText Format = iota // 仅文本日志（默认）
+	FormatJSON               // 仅 JSONL
+	FormatBoth               // 文本与 JSONL 并行写入
+)
+
+// ParseFormat 解析命令行中的日志格式：text / jsonl / both
+func ParseFormat(s string) (Format, error) {
+	switch s {
+	case "", "text":
+		return FormatText, nil
+	case "jsonl", "json":
+		return FormatJSON, nil
+	case "both":
+		return FormatBoth, nil
+	}
+	return FormatText, errors.New("未知的日志格式: " + s + "（可选 text/jsonl/both）")
+}
+
+// Text 是否写文本日志
+func (f Format) Text() bool {
+	return f != FormatJSON
+}
+
+// JSON 是否写 JSONL 日志
+func (f Format) JSON() bool {
+	return f != FormatText
+}
+
+// SessionStart 会话开始记录的 Kind
+const SessionStart = "SessionStart"
+
+// Entry 一条 JSONL 记录
+type Entry struct {
+	Session string          `json:"session"`              // 会话 ID
+	Time    int64           `json:"ts"`                   // 事件时间（Unix 毫秒）
+	Kind    string          `json:"kind"`                 // 事件类型，如 CommandExecuted、EditApplied
+	File    string          `json:"file"`                 // 文件路径
+	Command string          `json:"command,omitempty"`    // 指令名（CommandExecuted 为用户输入的指令名）
+	Input   string          `json:"input,omitempty"`      // 用户输入的原始指令
+	Params  json.RawMessage `json:"params,omitempty"`     // 参数：CommandExecuted 为参数列表，其他事件为结构化数据
+	Result  string          `json:"result,omitempty"`     // ok / error
+	Error   string          `json:"error,omitempty"`      // 错误信息
+	Version *int            `json:"version,omitempty"`    // 事件后的内容版本
+	Elapsed float64         `json:"elapsed_ms,omitempty"` // 指令耗时（毫秒）
+	Derived bool            `json:"derived,omitempty"`    // 由用户指令引起的事件（该指令另有 CommandExecuted 记录）
+}
+
+// Sink JSONL 日志观察者，按文件写入对应的 .jsonl
+type Sink struct {
+	resolver *logpath.Resolver
+	session  string
+
+	mu      sync.Mutex
+	files   map[string]*os.File // 日志路径 -> 已打开的 .jsonl
+	started map[string]bool     // 本会话已写入 SessionStart 的日志（按日志路径，重命名后随日志迁移）
+}
+
+// NewSink 创建 JSONL 日志观察者，resolver 为 nil 时使用 logpath.Default()
+func NewSink(resolver *logpath.Resolver) *Sink {
+	if resolver == nil {
+		resolver = logpath.Default()
+	}
+	return &Sink{
+		resolver: resolver,
+		session:  fmt.Sprintf("%s-%d", time.Now().Format("20060102T150405"), os.Getpid()),
+		files:    make(map[string]*os.File),
+		started:  make(map[string]bool),
+	}
+}
+
+// Session 本次会话的 ID
+func (s *Sink) Session() string {
+	return s.session
+}
+
+// Update 实现 Observer 接口：将开启日志的文件的事件转换为一条记录写入文件对应的 .jsonl
+// 重命名、另存为事件无论是否开启日志都要处理，日志已随文件迁移，原路径的句柄不能再使用
+func (s *Sink) Update(event common.WorkspaceEvent) {
+	if event.FilePath == "" {
+		return
+	}
+	if rename, ok := event.Payload.(common.RenamePayload); ok {
+		s.moved(rename.From, rename.To)
+	}
+	if !event.LogEnabled {
+		return
+	}
+	if err := s.write(event.FilePath, s.entry(event)); err != nil {
+		fmt.Printf("警告：写入 JSONL 日志失败: %v\n", err)
+	}
+}
+
+// entry 将事件转换为记录
+func (s *Sink) entry(event common.WorkspaceEvent) Entry {
+	entry := Entry{
+		Session: s.session,
+		Time:    event.Timestamp,
+		Kind:    event.Kind.String(),
+		File:    event.FilePath,
+		Command: event.Type,
+		Derived: event.Derived,
+	}
+	if entry.Time == 0 {
+		entry.Time = time.Now().UnixMilli()
+	}
+	switch payload := event.Payload.(type) {
+	case common.CommandPayload:
+		entry.Command = payload.Name
+		entry.Input = event.Command
+		entry.Params, _ = json.Marshal(payload.Args)
+		entry.Result = "ok"
+		if !payload.Success {
+			entry.Result = "error"
+			entry.Error = payload.Err
+		}
+		entry.Version = &payload.Version
+		entry.Elapsed = float64(payload.Duration.Microseconds()) / 1000
+		return entry
+	case common.EditPayload:
+		entry.Version = &payload.NewVersion
+	case common.HistoryPayload:
+		entry.Version = &payload.NewVersion
+	case common.LogToggledPayload:
+		entry.Version = &payload.NewVersion
+	case common.FilePayload:
+		entry.Version = &payload.Version
+	}
+	if event.Payload != nil {
+		entry.Params, _ = json.Marshal(event.Payload)
+	}
+	entry.Result = "ok"
+	return entry
+}
+
+// write 追加一条记录
+func (s *Sink) write(filePath string, entry Entry) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	file, err := s.open(filePath, entry.Time)
+	if err != nil {
+		return err
+	}
+	return writeEntry(file, entry)
+}
+
+// moved 文件重命名、另存为后日志已由工作区迁移：关闭原路径的句柄，本会话已写过 SessionStart 的日志在新路径下不再重复写入
+// 迁移失败（原路径的日志仍在）时两个日志各自保持原有状态
+func (s *Sink) moved(oldFile, newFile string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	oldLog := s.resolver.JSONPath(oldFile)
+	if file, ok := s.files[oldLog]; ok {
+		file.Close()
+		delete(s.files, oldLog)
+	}
+	if _, err := os.Stat(oldLog); err == nil {
+		return
+	}
+	if s.started[oldLog] {
+		delete(s.started, oldLog)
+		s.started[s.resolver.JSONPath(newFile)] = true
+	}
+}
+
+// open 返回文件对应的 .jsonl 句柄（按日志路径缓存）；本会话首次写入该日志时先写入 SessionStart 记录
+// 缓存的句柄与日志路径上的文件不再是同一个文件（日志被迁移、删除）时重新打开；SessionStart 写入失败时不缓存句柄，下次写入时重试
+func (s *Sink) open(filePath string, ts int64) (*os.File, error) {
+	path := s.resolver.JSONPath(filePath)
+	if file, ok := s.files[path]; ok {
+		if sameFile(file, path) {
+			return file, nil
+		}
+		file.Close()
+		delete(s.files, path)
+	}
+	path, err := s.resolver.EnsureJSON(filePath)
+	if err != nil {
+		return nil, err
+	}
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, err
+	}
+	if !s.started[path] {
+		if err := writeEntry(file, Entry{Session: s.session, Time: ts, Kind: SessionStart, File: filePath}); err != nil {
+			file.Close()
+			return nil, err
+		}
+		s.started[path] = true
+	}
+	s.files[path] = file
+	return file, nil
+}
+
+// sameFile 已打开的句柄是否仍是 path 上的文件
+func sameFile(file *os.File, path string) bool {
+	opened, err := file.Stat()
+	if err != nil {
+		return false
+	}
+	current, err := os.Stat(path)
+	return err == nil && os.SameFile(opened, current)
+}
+
+func writeEntry(file *os.File, entry Entry) error {
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	_, err = file.Write(append(data, '\n'))
+	return err
+}
+
+// Close 关闭所有已打开的日志文件（实现 io.Closer，退出时由工作区调用）
+func (s *Sink) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var firstErr error
+	for path, file := range s.files {
+		if err := file.Close(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+		delete(s.files, path)
+	}
+	return firstErr
+}
+
+// String 单行可读格式：时间、类型、指令或参数、结果、内容版本、耗时
+func (e Entry) String() string {
+	ts := time.UnixMilli(e.Time).Format("2006-01-02 15:04:05.000")
+	if e.Kind == SessionStart {
+		return fmt.Sprintf("%s ===== session %s =====", ts, e.Session)
+	}
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s %-15s", ts, e.Kind)
+	if e.Input != "" {
+		fmt.Fprintf(&b, " %s", e.Input)
+	} else {
+		if e.Command != "" {
+			fmt.Fprintf(&b, " %s", e.Command)
+		}
+		if len(e.Params) > 0 && string(e.Params) != "null" {
+			fmt.Fprintf(&b, " %s", e.Params)
+		}
+	}
+	fmt.Fprintf(&b, "  [%s", e.Result)
+	if e.Error != "" {
+		fmt.Fprintf(&b, ": %s", e.Error)
+	}
+	b.WriteString("]")
+	if e.Version != nil {
+		fmt.Fprintf(&b, " v%d", *e.Version)
+	}
+	if e.Elapsed > 0 {
+		fmt.Fprintf(&b, " %.3fms", e.Elapsed)
+	}
+	return b.String()
+}
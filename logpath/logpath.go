@@ -0,0 +1,158 @@
+package logpath
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// ------------------------------
+// 日志路径策略：log-show 读取、JSONL 日志写入与重命名时迁移日志共用同一套规则
+// ------------------------------
+//
+// 日志文件名为 .文件名.log（结构化日志为 .文件名.jsonl），集中存放在日志目录下（默认 ./logs），
+// 按文件相对于 root 的子目录分层，如 files/a/b.txt -> logs/a/.b.txt.log；root 以外的文件放在日志目录的 _abs 子目录中，按绝对路径分层。
+// 文本日志由日志模块（log）写入 ./logs，主程序因此固定使用 ./logs 作为日志目录。
+
+// Resolver 日志路径解析器
+type Resolver struct {
+	dir    string // 日志目录
+	root   string // 被编辑文件的根目录，日志目录按相对于它的路径分层
+	policy RotatePolicy
+}
+
+// New 创建日志路径解析器；dir 为日志目录（为空时使用 ./logs），root 一般为指令中相对路径的解析目录
+func New(dir, root string) *Resolver {
+	if dir == "" {
+		dir = "./logs"
+	}
+	return &Resolver{dir: dir, root: canonical(root)}
+}
+
+// canonical 转换为绝对、已解析符号链接的路径（失败时退回原路径），与工作区的规范路径保持一致
+func canonical(path string) string {
+	if path == "" {
+		return ""
+	}
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return path
+	}
+	if resolved, err := filepath.EvalSymlinks(abs); err == nil {
+		return resolved
+	}
+	return abs
+}
+
+// 日志文件的扩展名
+const (
+	TextExt = ".log"
+	JSONExt = ".jsonl"
+)
+
+// Path 返回文件对应的文本日志路径（不创建目录）
+func (r *Resolver) Path(filePath string) string {
+	return r.pathFor(filePath, TextExt)
+}
+
+// JSONPath 返回文件对应的 JSONL 日志路径（不创建目录）
+func (r *Resolver) JSONPath(filePath string) string {
+	return r.pathFor(filePath, JSONExt)
+}
+
+func (r *Resolver) pathFor(filePath, ext string) string {
+	return filepath.Join(r.dir, r.subdir(filePath), "."+filepath.Base(filePath)+ext)
+}
+
+// subdir 文件所在目录相对于 root 的路径；root 以外的文件使用 _abs 下的绝对路径
+func (r *Resolver) subdir(filePath string) string {
+	dir := filepath.Dir(filePath)
+	if r.root != "" {
+		if rel, err := filepath.Rel(r.root, dir); err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			return rel
+		}
+	}
+	abs, err := filepath.Abs(dir)
+	if err != nil {
+		abs = dir
+	}
+	abs = strings.TrimPrefix(abs, filepath.VolumeName(abs))
+	return filepath.Join("_abs", abs)
+}
+
+// EnsureJSON 返回文件对应的 JSONL 日志路径，并创建所在目录
+func (r *Resolver) EnsureJSON(filePath string) (string, error) {
+	return ensureDir(r.JSONPath(filePath))
+}
+
+func ensureDir(path string) (string, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return "", errors.New("创建日志目录失败: " + err.Error())
+	}
+	return path, nil
+}
+
+// Migrate 文件重命名后将文本与 JSONL 日志（含旧分段）移到新路径；没有日志时不做任何事，新路径已有日志时不覆盖
+func (r *Resolver) Migrate(oldFile, newFile string) error {
+	for _, ext := range []string{TextExt, JSONExt} {
+		if err := migrate(r.pathFor(oldFile, ext), r.pathFor(newFile, ext)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func migrate(oldLog, newLog string) error {
+	if oldLog == newLog {
+		return nil
+	}
+	if _, err := os.Stat(oldLog); err != nil {
+		if !os.IsNotExist(err) {
+			return err
+		}
+		if len(segments(oldLog)) == 0 {
+			return nil
+		}
+	}
+	if _, err := os.Lstat(newLog); err == nil || len(segments(newLog)) > 0 {
+		return errors.New("目标日志已存在: " + newLog)
+	}
+	if _, err := ensureDir(newLog); err != nil {
+		return err
+	}
+	// 旧分段随当前日志一起迁移
+	for _, id := range segments(oldLog) {
+		if err := os.Rename(segmentPath(oldLog, id), segmentPath(newLog, id)); err != nil {
+			return err
+		}
+	}
+	if _, err := os.Stat(oldLog); os.IsNotExist(err) {
+		return nil
+	}
+	return os.Rename(oldLog, newLog)
+}
+
+// ------------------------------
+// 默认解析器：由 main 设置，未指定解析器的 JSONL 日志使用
+// ------------------------------
+
+var (
+	defaultMu       sync.RWMutex
+	defaultResolver = New("./logs", "./files")
+)
+
+// SetDefault 设置默认解析器
+func SetDefault(r *Resolver) {
+	defaultMu.Lock()
+	defer defaultMu.Unlock()
+	defaultResolver = r
+}
+
+// Default 返回默认解析器
+func Default() *Resolver {
+	defaultMu.RLock()
+	defer defaultMu.RUnlock()
+	return defaultResolver
+}
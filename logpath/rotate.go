@@ -0,0 +1,215 @@
+package logpath
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ------------------------------
+// 日志轮转与保留策略
+// ------------------------------
+//
+// 轮转时当前日志压缩为 .apple.txt.log.1.gz（JSONL 日志为 .apple.txt.jsonl.1.gz），原有的 .1.gz、.2.gz… 依次后移，当前日志从空文件重新开始。
+// 工作区在本会话首次获得文件的锁、且尚未为该文件发出任何事件时调用 Rotate，因此一个会话的日志不会被拆开，
+// 也不会移走其他实例正在写入的日志。
+
+// RotatePolicy 轮转与保留策略（为 0 表示不按该条件轮转或清理；保留数量和时间默认为 0，即不删除旧分段）
+type RotatePolicy struct {
+	MaxSize     int64         // 当前日志超过该字节数时轮转
+	MaxSessions int           // 当前日志的会话数达到该值时轮转
+	Keep        int           // 最多保留的旧分段数
+	MaxAge      time.Duration // 旧分段的最长保留时间
+}
+
+// 日志模块在每个会话开头写入的行前缀，以及 JSONL 日志中会话开始记录的标识
+const (
+	sessionPrefix     = "session start at"
+	jsonSessionMarker = `"kind":"SessionStart"`
+)
+
+// SetRotatePolicy 设置轮转与保留策略
+func (r *Resolver) SetRotatePolicy(policy RotatePolicy) {
+	r.policy = policy
+}
+
+// segmentPath 第 n 个旧分段的路径（n 从 1 开始，越大越旧）
+func segmentPath(logPath string, n int) string {
+	return logPath + "." + strconv.Itoa(n) + ".gz"
+}
+
+// segments 返回日志的旧分段编号，从新到旧
+func segments(logPath string) []int {
+	matches, _ := filepath.Glob(GlobEscape(logPath) + ".*.gz")
+	var ids []int
+	for _, match := range matches {
+		id, err := strconv.Atoi(strings.TrimSuffix(strings.TrimPrefix(match, logPath+"."), ".gz"))
+		if err == nil && id > 0 {
+			ids = append(ids, id)
+		}
+	}
+	sort.Ints(ids)
+	return ids
+}
+
+// GlobEscape 转义路径中的通配符，供 filepath.Glob 按字面匹配该路径
+func GlobEscape(path string) string {
+	replacer := strings.NewReplacer(`*`, `\*`, `?`, `\?`, `[`, `\[`)
+	if filepath.Separator == '\\' {
+		replacer = strings.NewReplacer(`*`, `[*]`, `?`, `[?]`, `[`, `[[]`)
+	}
+	return replacer.Replace(path)
+}
+
+// countSessions 统计日志中的会话数
+func countSessions(logPath string) int {
+	file, err := os.Open(logPath)
+	if err != nil {
+		return 0
+	}
+	defer file.Close()
+	count := 0
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		if line := scanner.Text(); strings.HasPrefix(line, sessionPrefix) || strings.Contains(line, jsonSessionMarker) {
+			count++
+		}
+	}
+	return count
+}
+
+// needsRotate 当前日志是否达到轮转条件
+func (r *Resolver) needsRotate(logPath string) bool {
+	info, err := os.Stat(logPath)
+	if err != nil || info.Size() == 0 {
+		return false
+	}
+	if r.policy.MaxSize > 0 && info.Size() >= r.policy.MaxSize {
+		return true
+	}
+	return r.policy.MaxSessions > 0 && countSessions(logPath) >= r.policy.MaxSessions
+}
+
+// Rotate 文件的文本与 JSONL 日志达到轮转条件时压缩为新的旧分段，并按保留策略清理旧分段
+// 调用方需持有文件的锁，且本会话尚未写入该文件的日志
+func (r *Resolver) Rotate(filePath string) error {
+	for _, logPath := range []string{r.Path(filePath), r.JSONPath(filePath)} {
+		if err := r.rotateLog(logPath); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// rotate 旧分段编号依次加一，当前日志压缩为 .1.gz 后删除
+func rotate(logPath string) error {
+	ids := segments(logPath)
+	for i := len(ids) - 1; i >= 0; i-- {
+		if err := os.Rename(segmentPath(logPath, ids[i]), segmentPath(logPath, ids[i]+1)); err != nil {
+			return err
+		}
+	}
+	data, err := os.ReadFile(logPath)
+	if err != nil {
+		return err
+	}
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	if _, err := zw.Write(data); err != nil {
+		return err
+	}
+	if err := zw.Close(); err != nil {
+		return err
+	}
+	tmp := segmentPath(logPath, 1) + ".tmp"
+	if err := os.WriteFile(tmp, buf.Bytes(), 0644); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, segmentPath(logPath, 1)); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return os.Remove(logPath)
+}
+
+// prune 删除超出保留数量或超过保留时间的旧分段
+func (r *Resolver) prune(logPath string) error {
+	for i, id := range segments(logPath) {
+		path := segmentPath(logPath, id)
+		expired := r.policy.Keep > 0 && i >= r.policy.Keep
+		if !expired && r.policy.MaxAge > 0 {
+			if info, err := os.Stat(path); err == nil && time.Since(info.ModTime()) > r.policy.MaxAge {
+				expired = true
+			}
+		}
+		if expired {
+			if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// rotateLog 按日志路径执行轮转与清理
+func (r *Resolver) rotateLog(logPath string) error {
+	if r.needsRotate(logPath) {
+		if err := rotate(logPath); err != nil {
+			return err
+		}
+	}
+	return r.prune(logPath)
+}
+
+// ReadAll 按时间顺序读取文件的全部文本日志：从最旧的分段到当前日志，分段透明解压
+// 没有任何日志时返回 os.ErrNotExist
+func (r *Resolver) ReadAll(filePath string) ([]byte, error) {
+	return readAll(r.Path(filePath))
+}
+
+// ReadAllJSON 按时间顺序读取文件的全部 JSONL 日志
+func (r *Resolver) ReadAllJSON(filePath string) ([]byte, error) {
+	return readAll(r.JSONPath(filePath))
+}
+
+func readAll(logPath string) ([]byte, error) {
+	ids := segments(logPath)
+	var buf bytes.Buffer
+	for i := len(ids) - 1; i >= 0; i-- {
+		if err := readSegment(&buf, segmentPath(logPath, ids[i])); err != nil {
+			return nil, err
+		}
+	}
+	data, err := os.ReadFile(logPath)
+	if err != nil {
+		if !os.IsNotExist(err) || len(ids) == 0 {
+			return nil, err
+		}
+	}
+	buf.Write(data)
+	return buf.Bytes(), nil
+}
+
+// readSegment 解压一个旧分段追加到 buf
+func readSegment(buf *bytes.Buffer, path string) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	zr, err := gzip.NewReader(file)
+	if err != nil {
+		return err
+	}
+	defer zr.Close()
+	_, err = io.Copy(buf, zr)
+	return err
+}
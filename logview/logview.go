@@ -0,0 +1,404 @@
+package logview
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"lab1/jsonlog"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ------------------------------
+// log-show 的筛选与分页：按会话、时间、指令、关键字筛选日志，终端输出时经分页器显示
+// ------------------------------
+//
+// 文本日志以 "session start at <时间>" 行划分会话，其余每行为 "<yyyyMMdd HH:mm:ss> <指令> ..."；
+// JSONL 日志以 SessionStart 记录划分会话。两种格式解析为相同的记录后再筛选。
+
+// 文本日志中的时间格式与会话开始行前缀
+const (
+	textTimeLayout = "20060102 15:04:05"
+	sessionPrefix  = "session start at "
+)
+
+// Options log-show 的筛选选项
+type Options struct {
+	Session string    // last、all 或会话编号（从 1 开始，按时间先后），为空表示 all
+	Since   time.Time // 只显示该时间及之后的记录
+	Until   time.Time // 只显示该时间及之前的记录
+	Cmds    []string  // 只显示这些指令（不区分大小写）
+	Grep    string    // 只显示包含该文本的记录
+	Tail    int       // 只显示筛选后的最后 N 条记录（0 表示不限）
+	JSON    bool      // 读取 JSONL 日志
+}
+
+// Usage log-show 的用法
+const Usage = "用法: log-show [file] [--json] [--session last|N|all] [--since <time>] [--until <time>] [--cmd insert,delete] [--grep text] [--tail N]（含空格的参数用引号括起）"
+
+// SplitArgs 按空白拆分指令，双引号或单引号括起的部分（可含空格）作为一个参数；双引号内和引号外可用 \ 转义下一个字符
+func SplitArgs(input string) ([]string, error) {
+	var args []string
+	var current strings.Builder
+	inArg := false
+	var quote rune
+	escaped := false
+	for _, r := range input {
+		switch {
+		case escaped:
+			current.WriteRune(r)
+			escaped = false
+		case r == '\\' && quote != '\'':
+			escaped, inArg = true, true
+		case quote != 0:
+			if r == quote {
+				quote = 0
+			} else {
+				current.WriteRune(r)
+			}
+		case r == '"' || r == '\'':
+			quote, inArg = r, true
+		case r == ' ' || r == '\t':
+			if inArg {
+				args = append(args, current.String())
+				current.Reset()
+				inArg = false
+			}
+		default:
+			current.WriteRune(r)
+			inArg = true
+		}
+	}
+	if quote != 0 || escaped {
+		return nil, errors.New("引号或转义不完整: " + input)
+	}
+	if inArg {
+		args = append(args, current.String())
+	}
+	return args, nil
+}
+
+// ParseArgs 解析 log-show 的参数（SplitArgs 拆分后的指令各部分，不含指令名），返回筛选选项和其余参数（文件名）
+func ParseArgs(args []string) (Options, []string, error) {
+	var opts Options
+	var rest []string
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		if !strings.HasPrefix(arg, "--") {
+			rest = append(rest, arg)
+			continue
+		}
+		if arg == "--json" {
+			opts.JSON = true
+			continue
+		}
+		if i+1 >= len(args) {
+			return opts, nil, fmt.Errorf("%s 缺少参数\n%s", arg, Usage)
+		}
+		i++
+		value := args[i]
+		switch arg {
+		case "--session":
+			if value != "last" && value != "all" {
+				if n, err := strconv.Atoi(value); err != nil || n < 1 {
+					return opts, nil, errors.New("--session 只能为 last、all 或正整数")
+				}
+			}
+			opts.Session = value
+		case "--since", "--until":
+			t, err := ParseTime(value, time.Now())
+			if err != nil {
+				return opts, nil, err
+			}
+			if arg == "--since" {
+				opts.Since = t
+			} else {
+				if isDate(value) {
+					// 只给出日期时包含当天
+					t = t.AddDate(0, 0, 1).Add(-time.Nanosecond)
+				}
+				opts.Until = t
+			}
+		case "--cmd":
+			for _, cmd := range strings.Split(value, ",") {
+				if cmd = strings.TrimSpace(cmd); cmd != "" {
+					opts.Cmds = append(opts.Cmds, strings.ToLower(cmd))
+				}
+			}
+		case "--grep":
+			opts.Grep = value
+		case "--tail":
+			n, err := strconv.Atoi(value)
+			if err != nil || n < 0 {
+				return opts, nil, errors.New("--tail 只能为非负整数")
+			}
+			opts.Tail = n
+		default:
+			return opts, nil, fmt.Errorf("未知选项: %s\n%s", arg, Usage)
+		}
+	}
+	return opts, rest, nil
+}
+
+// timeLayouts --since/--until 接受的时间格式
+var timeLayouts = []string{
+	"2006-01-02T15:04:05",
+	"2006-01-02T15:04",
+	"2006-01-02",
+	"20060102T150405",
+	"20060102",
+}
+
+// ParseTime 解析 --since/--until 的时间：日期时间（如 2025-11-20、2025-11-20T16:20）、当天时间（如 16:20）或相对时长（如 2h、30m，表示 now 之前）
+func ParseTime(value string, now time.Time) (time.Time, error) {
+	for _, layout := range timeLayouts {
+		if t, err := time.ParseInLocation(layout, value, time.Local); err == nil {
+			return t, nil
+		}
+	}
+	for _, layout := range []string{"15:04:05", "15:04"} {
+		if t, err := time.ParseInLocation(layout, value, time.Local); err == nil {
+			y, m, d := now.Date()
+			return time.Date(y, m, d, t.Hour(), t.Minute(), t.Second(), 0, time.Local), nil
+		}
+	}
+	if d, err := time.ParseDuration(value); err == nil && d >= 0 {
+		return now.Add(-d), nil
+	}
+	return time.Time{}, errors.New("无法解析时间: " + value + "（如 2025-11-20、2025-11-20T16:20、16:20、2h）")
+}
+
+// isDate 时间参数只包含日期（如 2025-11-20、20251120）
+func isDate(value string) bool {
+	return !strings.ContainsAny(value, "T:hms")
+}
+
+// Record 一条日志记录
+type Record struct {
+	Time time.Time // 无法解析时间时为零值
+	Cmd  string    // 指令名（小写）
+	Text string    // 显示的文本
+}
+
+// Session 一个会话的日志
+type Session struct {
+	Number  int    // 会话编号，从 1 开始
+	Header  string // 会话开始行
+	Records []Record
+}
+
+// ParseText 解析文本日志；第一个会话开始行之前的记录归入编号为 0 的会话
+func ParseText(data []byte) []Session {
+	var sessions []Session
+	current := Session{}
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		if strings.HasPrefix(line, sessionPrefix) {
+			if current.Number > 0 || len(current.Records) > 0 {
+				sessions = append(sessions, current)
+			}
+			current = Session{Number: current.Number + 1, Header: line}
+			continue
+		}
+		record := Record{Text: line}
+		fields := strings.Fields(line)
+		if len(fields) >= 2 {
+			if t, err := time.ParseInLocation(textTimeLayout, fields[0]+" "+fields[1], time.Local); err == nil {
+				record.Time = t
+				if len(fields) >= 3 {
+					record.Cmd = strings.ToLower(fields[2])
+				}
+			}
+		}
+		current.Records = append(current.Records, record)
+	}
+	if current.Number > 0 || len(current.Records) > 0 {
+		sessions = append(sessions, current)
+	}
+	return sessions
+}
+
+// ParseJSON 解析 JSONL 日志，以 SessionStart 记录划分会话；无法解析的行原样保留
+func ParseJSON(data []byte) []Session {
+	var sessions []Session
+	current := Session{}
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		var entry jsonlog.Entry
+		if err := json.Unmarshal([]byte(line), &entry); err != nil {
+			current.Records = append(current.Records, Record{Text: line})
+			continue
+		}
+		if entry.Kind == jsonlog.SessionStart {
+			if current.Number > 0 || len(current.Records) > 0 {
+				sessions = append(sessions, current)
+			}
+			current = Session{Number: current.Number + 1, Header: entry.String()}
+			continue
+		}
+		record := Record{Time: time.UnixMilli(entry.Time), Text: entry.String()}
+		// 指令引起的事件不计入指令名，--cmd 只按用户指令（CommandExecuted）筛选，同一操作不重复出现
+		if !entry.Derived {
+			record.Cmd = strings.ToLower(entry.Command)
+		}
+		current.Records = append(current.Records, record)
+	}
+	if current.Number > 0 || len(current.Records) > 0 {
+		sessions = append(sessions, current)
+	}
+	return sessions
+}
+
+// Filter 按选项筛选会话和记录，去掉没有剩余记录的会话（只选择会话时保留空会话的开始行）
+func Filter(sessions []Session, opts Options) []Session {
+	switch opts.Session {
+	case "", "all":
+	case "last":
+		if len(sessions) > 0 {
+			sessions = sessions[len(sessions)-1:]
+		}
+	default:
+		n, _ := strconv.Atoi(opts.Session)
+		var selected []Session
+		for _, session := range sessions {
+			if session.Number == n {
+				selected = append(selected, session)
+			}
+		}
+		sessions = selected
+	}
+
+	recordFilter := !opts.Since.IsZero() || !opts.Until.IsZero() || len(opts.Cmds) > 0 || opts.Grep != "" || opts.Tail > 0
+	var result []Session
+	for _, session := range sessions {
+		kept := session
+		kept.Records = nil
+		for _, record := range session.Records {
+			if opts.match(record) {
+				kept.Records = append(kept.Records, record)
+			}
+		}
+		if len(kept.Records) > 0 || !recordFilter {
+			result = append(result, kept)
+		}
+	}
+	if opts.Tail > 0 {
+		result = tail(result, opts.Tail)
+	}
+	return result
+}
+
+// match 记录是否满足时间、指令和关键字条件
+func (opts Options) match(record Record) bool {
+	if !opts.Since.IsZero() && (record.Time.IsZero() || record.Time.Before(opts.Since)) {
+		return false
+	}
+	if !opts.Until.IsZero() && (record.Time.IsZero() || record.Time.After(opts.Until)) {
+		return false
+	}
+	if len(opts.Cmds) > 0 {
+		found := false
+		for _, cmd := range opts.Cmds {
+			if record.Cmd == cmd {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return opts.Grep == "" || strings.Contains(record.Text, opts.Grep)
+}
+
+// tail 只保留最后 n 条记录及其所属会话
+func tail(sessions []Session, n int) []Session {
+	var result []Session
+	for i := len(sessions) - 1; i >= 0 && n > 0; i-- {
+		session := sessions[i]
+		if len(session.Records) > n {
+			session.Records = session.Records[len(session.Records)-n:]
+		}
+		n -= len(session.Records)
+		result = append([]Session{session}, result...)
+	}
+	return result
+}
+
+// Render 输出会话和记录
+func Render(w io.Writer, sessions []Session) {
+	for _, session := range sessions {
+		if session.Header != "" {
+			fmt.Fprintln(w, session.Header)
+		}
+		for _, record := range session.Records {
+			fmt.Fprintln(w, record.Text)
+		}
+	}
+}
+
+// ------------------------------
+// 分页器
+// ------------------------------
+
+// isTerminal 标准输出是否为终端
+func isTerminal(file *os.File) bool {
+	info, err := file.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+// Page 标准输出为终端时经分页器（$PAGER，默认 less -FRX）显示，否则直接输出
+// 分页器无法启动或异常退出（如未安装、选项不支持）时直接输出，默认的 less 不存在时（如 Windows）不提示；分页器被信号终止时不再重复输出
+// 调用方负责在分页期间忽略 SIGINT（Ctrl+C 由分页器处理）
+func Page(content string) {
+	if !isTerminal(os.Stdout) {
+		fmt.Print(content)
+		return
+	}
+	pager := strings.TrimSpace(os.Getenv("PAGER"))
+	custom := pager != ""
+	if !custom {
+		pager = "less -FRX"
+	}
+	err := runPager(pager, content)
+	var exitErr *exec.ExitError
+	if err == nil || (errors.As(err, &exitErr) && exitErr.ExitCode() < 0) {
+		return
+	}
+	if custom || !errors.Is(err, exec.ErrNotFound) {
+		fmt.Printf("警告：分页器 %q 运行失败（%v），直接输出\n", pager, err)
+	}
+	fmt.Print(content)
+}
+
+// runPager 按 SplitArgs 的规则拆分分页器命令后直接执行（不经过 shell，Windows 上同样可用），content 作为其标准输入
+func runPager(pager, content string) error {
+	args, err := SplitArgs(pager)
+	if err != nil {
+		return err
+	}
+	if len(args) == 0 || args[0] == "" {
+		return errors.New("分页器命令为空")
+	}
+	cmd := exec.Command(args[0], args[1:]...)
+	cmd.Stdin = strings.NewReader(content)
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	return cmd.Run()
+}
@@ -2,181 +2,499 @@ package main
 
 import (
 	"bufio"
+	"errors"
+	"flag"
 	"fmt"
 	"lab1/common"
 	"lab1/editor"
+	"lab1/eventbus"
+	"lab1/jsonlog"
 	"lab1/log"
+	"lab1/logpath"
+	"lab1/logview"
+	"lab1/prompt"
+	"lab1/revision"
 	"lab1/storage"
+	"lab1/textdiff"
 	"lab1/workspace"
 	"os"
+	"os/signal"
 	"path/filepath"
 	"strconv"
 	"strings"
+	"sync"
+	"syscall"
+	"time"
 )
 
 //TIP <p>To run your code, right-click the code and select <b>Run</b>.</p> <p>Alternatively, click
 // the <icon src="AllIcons.Actions.Execute"/> icon in the gutter and select the <b>Run</b> menu item from here.</p>
 
 func main() {
+	// 0. 解析命令行参数
+	backup := flag.String("backup", "none", "保存前备份旧文件: none / simple(file~) / timestamped")
+	backupKeep := flag.Int("backup-keep", 5, "timestamped 备份的保留数量（<=0 不清理）")
+	autosave := flag.Duration("autosave", 30*time.Second, "定时为已修改的文件写交换文件的间隔（0 表示关闭）")
+	autosaveEdits := flag.Int("autosave-edits", 20, "累计编辑 N 次后写交换文件（0 表示关闭）")
+	revKeep := flag.Int("rev-keep", 50, "每个文件最多保留的修订数（0 表示不限）")
+	revMaxAge := flag.Duration("rev-max-age", 30*24*time.Hour, "修订的最长保留时间（0 表示不限）")
+	mementoBuffers := flag.String("memento-buffers", "embed", "退出时未保存缓冲区内容的保存方式: embed / sidecar / off")
+	root := flag.String("root", "./files", "指令中相对路径的解析目录")
+	onDirty := flag.String("on-dirty", "prompt", "关闭、退出时已修改文件的处理: prompt（询问）/ save / discard / fail")
+	logFormat := flag.String("log-format", "text", "日志格式: text（文本）/ jsonl（结构化 JSON Lines）/ both（两者并行写入）")
+	logMaxSize := flag.Int64("log-max-size", 1<<20, "日志超过该字节数时在会话开始时轮转（0 表示不按大小轮转）")
+	logMaxSessions := flag.Int("log-max-sessions", 0, "日志的会话数达到该值时轮转（0 表示不按会话数轮转）")
+	logKeep := flag.Int("log-keep", 0, "每个日志最多保留的压缩旧分段数（0 表示不限）")
+	logMaxAge := flag.Duration("log-max-age", 0, "旧分段的最长保留时间（0 表示不限）")
+	flag.Parse()
+
 	// 1. 初始化依赖组件
 	fileStorage := storage.NewLocalStorage("./workspace_state.json") // 状态存储路径
+	// 日志路径策略：与日志模块写入文本日志的位置（./logs）一致，供 log-show、JSONL 日志和重命名时迁移日志使用
+	logPaths := logpath.New("./logs", *root)
+	logPaths.SetRotatePolicy(logpath.RotatePolicy{MaxSize: *logMaxSize, MaxSessions: *logMaxSessions, Keep: *logKeep, MaxAge: *logMaxAge})
+	logpath.SetDefault(logPaths)
 	logModule := log.NewLogModule()
 
 	// 2. 初始化工作区
 	ws := workspace.NewWorkspace("./workspace_state.json")
+	ws.SetLogResolver(logPaths)
 
-	// 3. 日志模块订阅工作区事件（观察者模式）
-	ws.RegisterObserver(logModule)
+	backupMode, err := workspace.ParseBackupMode(*backup)
+	if err != nil {
+		fmt.Printf("%v，不进行备份\n", err)
+	}
+	ws.SetSaveOptions(workspace.SaveOptions{Backup: backupMode, BackupKeep: *backupKeep})
+	ws.SetSwapOptions(workspace.SwapOptions{Interval: *autosave, EveryEdits: *autosaveEdits})
+	revisions := revision.NewStore("./.fdu")
+	revisions.SetPrunePolicy(revision.PrunePolicy{MaxCount: *revKeep, MaxAge: *revMaxAge})
+	ws.SetRevisionStore(revisions)
+	bufferMode, err := workspace.ParseBufferMode(*mementoBuffers)
+	if err != nil {
+		fmt.Printf("%v，使用 embed\n", err)
+	}
+	ws.SetBufferMode(bufferMode, "./.fdu/buffers")
+	prompter, err := prompt.ForPolicy(*onDirty, prompt.NewInteractive(stdin, os.Stdout))
+	onDirtyPolicy = *onDirty
+	if err != nil {
+		fmt.Printf("%v，改为询问\n", err)
+		onDirtyPolicy = "prompt"
+	}
+	ws.SetPrompter(prompter)
+	// 覆盖已有文件总是交互确认，不受 -on-dirty 策略影响
+	ws.SetOverwritePrompter(prompt.NewInteractive(stdin, os.Stdout))
+
+	// 3. 日志模块订阅工作区事件（观察者模式）：文本日志只记录用户输入的原始指令，JSONL 日志记录全部事件
+	format, err := jsonlog.ParseFormat(*logFormat)
+	if err != nil {
+		fmt.Printf("%v，使用 text\n", err)
+	}
+	if format.Text() {
+		ws.Subscribe(logModule, eventbus.Options{Filter: eventbus.Filter{Kinds: []common.EventKind{common.EventCommandExecuted}, Log: true}})
+	}
+	if format.JSON() {
+		// 不按日志开关过滤：关闭日志的文件重命名时也要更新已打开的句柄，由 Sink 自行跳过其他事件
+		ws.Subscribe(jsonlog.NewSink(logPaths), eventbus.Options{Name: "jsonlog"})
+	}
 
 	//日志模块订阅编辑器事件
 
-	// 4. 从本地存储恢复上次工作区状态（备忘录模式）
-	if err := restoreWorkspaceState(ws, fileStorage); err != nil {
+	// 上次使用了命名会话时恢复该会话，否则使用默认的工作区状态文件
+	ws.SetRoot(*root)
+	ws.SetSessionDir("./.fdu/sessions")
+	ws.SetRecentFile("./.fdu/recent", 20)
+	if name := ws.UseLastSession(); name != "" {
+		fmt.Printf("使用上次的会话: %s\n", name)
+	}
+
+	// 4. 锁定工作区状态文件，防止多个实例互相覆盖；再从本地存储恢复上次工作区状态（备忘录模式）
+	ws.AcquireStateLock()
+	if report, err := restoreWorkspaceState(ws, fileStorage); err != nil {
 		fmt.Printf("恢复工作区失败，使用新状态: %v\n", err)
+	} else if len(report.Failures) > 0 {
+		fmt.Printf("工作区已部分恢复：%s\n", report.Summary())
 	} else {
-		fmt.Println("工作区已恢复上次状态")
+		fmt.Printf("工作区已恢复上次状态：%s\n", report.Summary())
 	}
 
-	// 5. 启动交互循环，处理用户指令
+	// 提示上次异常退出遗留的交换文件
+	_listSwaps(ws)
+
+	// 5. 后台轮询已打开文件在磁盘上的变化，并定时写交换文件
+	ws.StartWatcher(2 * time.Second)
+	ws.StartAutosave()
+
+	// 6. 启动交互循环，处理用户指令；输入结束或收到信号时保存状态后退出
+	handleSignals(ws)
 	startInteractiveLoop(ws)
 }
 
 // 修复后的 restoreWorkspaceState 函数
-func restoreWorkspaceState(ws *workspace.Workspace, storage *storage.LocalStorage) error {
+func restoreWorkspaceState(ws *workspace.Workspace, storage *storage.LocalStorage) (*workspace.RestoreReport, error) {
 	// 调用 Workspace 的 RestoreState 方法，传入编辑器工厂函数
 	// 工厂函数复用之前定义的 editor.EditorFactory（需确保已导入 editor 包）
-	return ws.RestoreState(editor.EditorFactory)
+	return ws.RestoreState(editor.EditorFactory, editor.BufferFactory)
 }
 
 // 启动用户交互循环
+// stdin 交互循环与确认提示共用的输入
+var stdin = bufio.NewScanner(os.Stdin)
+
 func startInteractiveLoop(ws *workspace.Workspace) {
-	scanner := bufio.NewScanner(os.Stdin)
 	fmt.Println("编辑器启动完成，支持指令: load/save/close/undo/exit....")
 
 	for {
 		fmt.Print("> ")
-		if !scanner.Scan() {
+		if !stdin.Scan() {
 			break
 		}
-		input := scanner.Text()
+		input := stdin.Text()
+		// 与后台轮询互斥，避免执行指令时缓冲区被重新加载
+		ws.Lock()
 		handleCommand(ws, input, true)
+		ws.AutosaveAfterEdits()
 		//fmt.Printf("[debug]active_file: %s\n", ws.GetActiveEditor().GetFilePath())
 		activeEditor := ws.GetActiveEditor()
 		if activeEditor == nil {
 			fmt.Println("[debug]active_file: 无激活的编辑器/文件")
 		} else {
-			fmt.Printf("[debug]active_file: %s\n", activeEditor.GetFilePath())
+			fmt.Printf("[debug]active_file: %s\n", ws.DisplayName(activeEditor.GetFilePath()))
 		}
+		ws.Unlock()
 	}
+
+	// 输入结束（如管道、Ctrl+D）时同样保存状态后退出
+	ws.Lock()
+	shutdown(ws, "EOF", 0)
 }
 
-// 处理用户指令
+// 处理用户指令：执行后为目标文件发布一条 CommandExecuted 事件，记录用户输入的原始指令、结果和耗时
 func handleCommand(ws *workspace.Workspace, input string, debug bool) {
 	parts := strings.SplitN(input, " ", 4)
 	if len(parts) == 0 {
 		fmt.Println("无效指令")
 		return
 	}
-	cmd := parts[0]
-	switch cmd {
+	// 执行前确定目标文件：close 等指令执行后目标文件已不在工作区
+	before := commandTarget(ws, input, parts)
+	logBefore := before != nil && before.IsLogEnabled()
+
+	start := time.Now()
+	ws.BeginCommand()
+	err := dispatch(ws, input, parts, debug)
+	ws.EndCommand()
+	duration := time.Since(start)
+	if err != nil {
+		fmt.Println(err)
+	}
+
+	target, logEnabled := before, logBefore
+	if before == nil || ws.OpenEditors[before.GetFilePath()] == before {
+		// load、edit、log-on 等指令执行后目标文件才确定或才启用日志
+		if after := commandTarget(ws, input, parts); after != nil {
+			target, logEnabled = after, after.IsLogEnabled() || (after == before && logBefore)
+		}
+	}
+	// exit 确认后先记录指令再退出，退出流程会等日志写完
+	if parts[0] == "exit" && err == nil {
+		defer shutdown(ws, "exit", 0)
+	}
+	if target == nil {
+		return
+	}
+	payload := common.CommandPayload{
+		Name:     parts[0],
+		Args:     parts[1:],
+		Success:  err == nil,
+		Duration: duration,
+		Version:  target.Version(),
+	}
+	if err != nil {
+		payload.Err = err.Error()
+	}
+	ws.NotifyObservers(common.WorkspaceEvent{
+		FilePath:   target.GetFilePath(),
+		Kind:       common.EventCommandExecuted,
+		Payload:    payload,
+		Type:       parts[0],
+		Command:    input,
+		Timestamp:  time.Now().UnixMilli(),
+		LogEnabled: logEnabled,
+	})
+}
+
+// commandTarget 指令作用的文件：参数中指定的已打开文件，否则为活动文件
+func commandTarget(ws *workspace.Workspace, input string, parts []string) common.Editor {
+	if name := commandFileArg(input, parts); name != "" {
+		if _editor, exists := ws.FindEditor(name); exists {
+			return _editor
+		}
+	}
+	return ws.GetActiveEditor()
+}
+
+// commandFileArg 指令参数中的文件名，按各指令的用法解析；不接受文件参数或未指定时返回空
+// append、insert 等指令的参数是文本，save-as、rename 的参数是新路径，都作用于活动文件
+func commandFileArg(input string, parts []string) string {
+	switch parts[0] {
+	case "load", "save", "close", "init", "edit", "log-on", "log-off", "recover", "discard", "revisions", "show-rev":
+		if len(parts) > 1 {
+			return parts[1]
+		}
+	case "reload":
+		for _, part := range parts[1:] {
+			if part != "--force" {
+				return part
+			}
+		}
+	case "diff-rev":
+		// diff-rev [file] <a> <b>
+		if len(parts) == 4 {
+			return parts[1]
+		}
+	case "log-show":
+		if fields, err := logview.SplitArgs(input); err == nil {
+			if _, args, err := logview.ParseArgs(fields[1:]); err == nil && len(args) == 1 {
+				return args[0]
+			}
+		}
+	}
+	return ""
+}
+
+// dispatch 执行单条指令，失败时返回错误
+func dispatch(ws *workspace.Workspace, input string, parts []string, debug bool) error {
+	switch parts[0] {
 	case "load": //完成
-		_load(ws, parts, false)
+		return _load(ws, parts, false)
 	case "save": //完成
-		_Save(ws, input, debug, parts)
+		return _Save(ws, input, debug, parts)
 	case "close": //完成
-		_close(ws, parts)
+		return _close(ws, parts)
 	case "init": //完成
-		_init(ws, parts)
+		return _init(ws, parts)
 	case "undo":
-		_undo(ws)
+		return _undo(ws)
 	case "redo":
-		_redo(ws)
+		return _redo(ws)
 	case "editor-list": //完成
-		_EditorList(ws)
+		return _EditorList(ws)
 	case "edit": //完成
-		_edit(ws, parts)
+		return _edit(ws, parts)
 	case "exit":
-		_exit(ws)
+		return _exit(ws)
 	case "dir-tree": //完成
-		_dirTree(ws, parts)
+		return _dirTree(ws, parts)
 	case "append":
-		_append(ws, parts)
+		return _append(ws, parts)
 	case "insert":
-		_insert(ws, parts)
+		return _insert(ws, parts)
 	case "show":
-		_show(ws, parts)
+		return _show(ws, parts)
 	case "delete":
-		_delete(ws, parts)
+		return _delete(ws, parts)
 	case "replace":
-		_replace(ws, parts)
+		return _replace(ws, parts)
 	case "log-on":
-		_LogOn(ws, parts)
+		return _LogOn(ws, parts)
 	case "log-off":
-		_LogOff(ws, parts)
+		return _LogOff(ws, parts)
 	case "log-show":
-		_LogShow(ws, parts)
+		args, err := logview.SplitArgs(input)
+		if err != nil {
+			return err
+		}
+		return _LogShow(ws, args)
+	case "reload":
+		return _reload(ws, parts)
+	case "recover":
+		return _recover(ws, parts)
+	case "discard":
+		return _discard(ws, parts)
+	case "revisions":
+		return _revisions(ws, parts)
+	case "show-rev":
+		return _showRev(ws, parts)
+	case "diff-rev":
+		return _diffRev(ws, parts)
+	case "revert":
+		return _revert(ws, parts)
+	case "conflicts":
+		return _conflicts(ws)
+	case "resolve":
+		return _resolve(ws, parts)
+	case "session":
+		return _session(ws, parts)
+	case "save-as":
+		return _saveAs(ws, parts)
+	case "rename":
+		return _rename(ws, parts)
+	case "back":
+		return _back(ws)
+	case "forward":
+		return _forward(ws)
+	case "recent":
+		return _recent(ws, parts)
 	default:
-		fmt.Println("未知指令，支持: load/save/close/undo/exit")
+		return errors.New("未知指令，支持: load/save/close/undo/exit")
 	}
 }
-func _load(ws *workspace.Workspace, parts []string, debug bool) {
+func _load(ws *workspace.Workspace, parts []string, debug bool) error {
 	if len(parts) < 2 {
-		fmt.Println("请指定文件路径: load [path]")
-		return
+		return errors.New("请指定文件路径: load [path]")
 	}
 	_editor, err := ws.LoadFile(parts[1], editor.EditorFactory)
 	if err != nil {
-		fmt.Printf("加载失败: %v\n", err)
+		return fmt.Errorf("加载失败: %w", err)
+	}
+	if _editor.IsNew() {
+		fmt.Printf("已创建新文件: %s（未保存，save 后写入磁盘）\n", ws.DisplayName(_editor.GetFilePath()))
 	} else {
 		fmt.Printf("已加载文件: %s（%s）\n",
-			_editor.GetFilePath(),
+			ws.DisplayName(_editor.GetFilePath()),
 			map[bool]string{true: "已修改", false: "未修改"}[_editor.IsModified()])
 		if debug {
-			fmt.Println("[debug] 当前活动文件是" + ws.GetActiveEditor().GetFilePath())
+			fmt.Println("[debug] 当前活动文件是" + ws.DisplayName(ws.GetActiveEditor().GetFilePath()))
 		}
 	}
+	return nil
 }
 
-func _close(ws *workspace.Workspace, parts []string) {
+func _close(ws *workspace.Workspace, parts []string) error {
 	if len(parts) < 2 {
-		fmt.Println("请指定文件路径: close [path]")
-		return
+		return errors.New("请指定文件路径: close [path]")
 	}
-	if err := ws.CloseFile(parts[1]); err != nil {
-		fmt.Printf("关闭失败: %v\n", err)
-	} else {
-		fmt.Printf("已关闭文件: %s\n", parts[1])
+	if err := ws.CloseFile(parts[1]); errors.Is(err, workspace.ErrCancelled) {
+		return errors.New("已取消关闭")
+	} else if err != nil {
+		return fmt.Errorf("关闭失败: %w", err)
 	}
+	fmt.Printf("已关闭文件: %s\n", parts[1])
+	return nil
 }
 
-func _undo(ws *workspace.Workspace) {
-	if err := ws.GetActiveEditor().Undo(); err != nil {
-		fmt.Printf("undo失败: %v\n", err)
-	} else {
-		fmt.Println("undo成功")
+func _undo(ws *workspace.Workspace) error {
+	activeEditor := ws.GetActiveEditor()
+	if activeEditor == nil {
+		return errors.New("没有活动文件")
+	}
+	if err := activeEditor.Undo(); err != nil {
+		return fmt.Errorf("undo失败: %w", err)
 	}
+	fmt.Println("undo成功")
+	return nil
+}
 
+func _redo(ws *workspace.Workspace) error {
+	activeEditor := ws.GetActiveEditor()
+	if activeEditor == nil {
+		return errors.New("没有活动文件")
+	}
+	if err := activeEditor.Redo(); err != nil {
+		return fmt.Errorf("redo失败: %w", err)
+	}
+	fmt.Println("redo成功")
+	return nil
 }
 
-func _redo(ws *workspace.Workspace) {
-	if err := ws.GetActiveEditor().Redo(); err != nil {
-		fmt.Printf("redo失败: %v\n", err)
-	} else {
-		fmt.Println("redo成功")
+// _exit 逐个询问已修改的文件是否保存，取消时不退出；成功返回后由 handleCommand 记录指令并执行退出流程
+func _exit(ws *workspace.Workspace) error {
+	if err := ws.ConfirmUnsaved(); errors.Is(err, workspace.ErrCancelled) {
+		return errors.New("已取消退出")
+	} else if err != nil {
+		return fmt.Errorf("退出失败: %w", err)
 	}
+	return nil
+}
+
+var (
+	shutdownOnce  sync.Once
+	onDirtyPolicy string // -on-dirty 策略，输入结束或收到信号时使用
+)
+
+// shutdown 统一的退出流程（exit 指令、输入结束、信号），调用方需持有工作区锁
+// 停止后台任务，处理已修改的文件，保存工作区状态，关闭日志等资源，释放锁后退出
+func shutdown(ws *workspace.Workspace, reason string, code int) {
+	shutdownOnce.Do(func() {
+		ws.StopWatcher()
+		ws.StopAutosave()
+
+		// exit 指令已逐个询问过；输入结束或收到信号时无法再询问，仅按明确指定的策略处理
+		if reason != "exit" && onDirtyPolicy != "prompt" {
+			if err := ws.ConfirmUnsaved(); err != nil {
+				fmt.Printf("处理未保存的修改失败: %v\n", err)
+			}
+		}
+
+		// 退出前保存工作区状态（状态文件被其他实例锁定时跳过）
+		saved := false
+		if ws.StateLockedByOther() {
+			fmt.Println("工作区状态正被另一个实例使用，未保存")
+		} else {
+			memento := ws.CreateMemento()
+			ws.WriteSidecars(memento)
+			if err := storage.NewLocalStorage(ws.MementoPath()).SaveMemento(memento); err != nil {
+				fmt.Printf("保存工作区状态失败: %v\n", err)
+			} else {
+				ws.PruneSidecars(memento)
+				saved = true
+			}
+		}
+
+		// 未保存的内容已记录在工作区状态中时删除本次会话的交换文件，否则保留交换文件以便下次 recover
+		if saved && ws.BuffersPersisted() {
+			ws.RemoveSwapFiles()
+		} else if n := ws.FlushSwapFiles(); n > 0 {
+			fmt.Printf("%d 个文件的未保存修改已保留在交换文件中，下次启动可使用 recover 恢复\n", n)
+		}
+
+		ws.CloseObservers()
+		ws.ReleaseLocks()
+		fmt.Println("程序退出")
+		os.Exit(code)
+	})
 }
 
-func _exit(ws *workspace.Workspace) {
-	// 退出前保存工作区状态
-	memento := ws.CreateMemento()
-	if err := storage.NewLocalStorage("./workspace_state.json").SaveMemento(memento); err != nil {
-		fmt.Printf("保存工作区状态失败: %v\n", err)
+// signalCh handleSignals 接收信号的通道（未调用 handleSignals 时为 nil）
+var signalCh chan os.Signal
+
+// withoutInterrupt 运行分页器等前台子进程期间忽略 SIGINT，结束后恢复由 handleSignals 处理
+func withoutInterrupt(run func()) {
+	if signalCh == nil {
+		run()
+		return
 	}
-	fmt.Println("程序退出")
-	os.Exit(0)
+	signal.Ignore(os.Interrupt)
+	defer signal.Notify(signalCh, os.Interrupt)
+	run()
+}
+
+// handleSignals 收到 SIGINT/SIGTERM/SIGHUP 时走统一的退出流程，退出过程中再次按 Ctrl+C 强制退出
+func handleSignals(ws *workspace.Workspace) {
+	signals := make(chan os.Signal, 2)
+	signalCh = signals
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM, syscall.SIGHUP)
+	go func() {
+		sig := <-signals
+		code := 1
+		if s, ok := sig.(syscall.Signal); ok {
+			code = 128 + int(s)
+		}
+		fmt.Printf("\n收到信号 %v，正在保存工作区状态并退出（再次按 Ctrl+C 强制退出）\n", sig)
+		go func() {
+			ws.Lock()
+			shutdown(ws, sig.String(), code)
+		}()
+		for sig := range signals {
+			if sig == os.Interrupt {
+				fmt.Println("\n强制退出")
+				os.Exit(code)
+			}
+		}
+	}()
 }
 
-func _dirTree(ws *workspace.Workspace, parts []string) {
+func _dirTree(ws *workspace.Workspace, parts []string) error {
 	// 确定目标目录（默认当前工作目录）
 	targetDir := "."
 	if len(parts) >= 2 {
@@ -185,74 +503,468 @@ func _dirTree(ws *workspace.Workspace, parts []string) {
 
 	// 验证目录是否存在
 	if _, err := os.Stat(targetDir); err != nil {
-		fmt.Printf("目录不存在: %v\n", err)
-		return
+		return fmt.Errorf("目录不存在: %w", err)
 	}
 
 	// 生成并打印目录树
 	tree, err := generateDirectoryTree(targetDir)
 	if err != nil {
-		fmt.Printf("生成目录树失败: %v\n", err)
-		return
+		return fmt.Errorf("生成目录树失败: %w", err)
 	}
 	fmt.Print(tree)
+	return nil
 }
 
-func _LogOn(ws *workspace.Workspace, parts []string) {
+func _LogOn(ws *workspace.Workspace, parts []string) error {
 	targetEditor := getTargetEditor(ws, parts) // 解析目标文件（见下方辅助函数）
 	if targetEditor == nil {
-		fmt.Println("错误：文件未找到或无活动文件")
-		return
+		return errors.New("错误：文件未找到或无活动文件")
 	}
 	targetEditor.SetLogEnabled(true)
-	fmt.Printf("已为文件 %s 启用日志\n", targetEditor.GetFilePath())
+	fmt.Printf("已为文件 %s 启用日志\n", ws.DisplayName(targetEditor.GetFilePath()))
+	return nil
 }
 
 // 处理log-off：关闭指定文件/当前活动文件的日志
-func _LogOff(ws *workspace.Workspace, parts []string) {
+func _LogOff(ws *workspace.Workspace, parts []string) error {
 	targetEditor := getTargetEditor(ws, parts)
 	if targetEditor == nil {
-		fmt.Println("错误：文件未找到或无活动文件")
-		return
+		return errors.New("错误：文件未找到或无活动文件")
 	}
 	targetEditor.SetLogEnabled(false)
-	fmt.Printf("已关闭文件 %s 的日志\n", targetEditor.GetFilePath())
+	fmt.Printf("已关闭文件 %s 的日志\n", ws.DisplayName(targetEditor.GetFilePath()))
+	return nil
 }
 
-// 处理log-show：显示指定文件/当前活动文件的日志
-func _LogShow(ws *workspace.Workspace, parts []string) {
-	targetEditor := getTargetEditor(ws, parts)
+// 处理log-show：显示指定文件/当前活动文件的日志，可按会话、时间、指令、关键字筛选，--json 时显示格式化后的 JSONL 日志
+// parts 由 logview.SplitArgs 拆分（选项数量不定，不使用 SplitN；含空格的文本、文件名用引号括起）
+func _LogShow(ws *workspace.Workspace, parts []string) error {
+	opts, args, err := logview.ParseArgs(parts[1:])
+	if err != nil {
+		return err
+	}
+	if len(args) > 1 {
+		return errors.New(logview.Usage)
+	}
+	targetEditor := getTargetEditor(ws, append([]string{parts[0]}, args...))
 	if targetEditor == nil {
-		fmt.Println("错误：文件未找到或无活动文件")
-		return
+		return errors.New("错误：文件未找到或无活动文件")
 	}
 
-	//fmt.Printf("s%",logFilePath)
-
-	// 打印原始文件路径和计算的日志路径（用于调试）
-	fmt.Printf("调试：目标文件路径 = %q\n", targetEditor.GetFilePath())
-	// logFilePath := "." + filePath + ".log"
-	logFilePath := "." + targetEditor.GetFilePath() + ".log"
-	fmt.Printf("调试：日志文件路径 = %q\n", logFilePath) // 检查路径是否正确
+	// 事件由日志模块异步写入，读取前等待已发出的事件处理完毕
+	ws.FlushEvents()
 
-	content, err := os.ReadFile(logFilePath)
+	// 包括已轮转的旧分段
+	resolver := ws.LogResolver()
+	logFilePath := resolver.Path(targetEditor.GetFilePath())
+	read, parse := resolver.ReadAll, logview.ParseText
+	if opts.JSON {
+		logFilePath = resolver.JSONPath(targetEditor.GetFilePath())
+		read, parse = resolver.ReadAllJSON, logview.ParseJSON
+	}
+	content, err := read(targetEditor.GetFilePath())
 	if err != nil {
 		if os.IsNotExist(err) {
-			fmt.Printf("日志文件不存在：%s\n", logFilePath)
-			return
+			return fmt.Errorf("日志文件不存在：%s", logFilePath)
 		}
-		fmt.Printf("读取日志失败：%v\n", err)
+		return fmt.Errorf("读取日志失败：%w", err)
+	}
+
+	var out strings.Builder
+	fmt.Fprintf(&out, "===== 日志内容（%s） =====\n", logFilePath)
+	sessions := logview.Filter(parse(content), opts)
+	if len(sessions) == 0 {
+		out.WriteString("没有符合条件的日志记录\n")
+	}
+	logview.Render(&out, sessions)
+
+	// 分页期间释放工作区锁（内容已读出），后台轮询和自动保存不被阻塞；Ctrl+C 交给分页器，不触发退出流程
+	ws.Unlock()
+	defer ws.Lock()
+	withoutInterrupt(func() { logview.Page(out.String()) })
+	return nil
+}
+
+// 处理reload：从磁盘重新加载指定文件/当前活动文件，--force 时丢弃未保存的修改
+func _reload(ws *workspace.Workspace, parts []string) error {
+	force := false
+	args := make([]string, 0, len(parts))
+	for _, part := range parts {
+		if part == "--force" {
+			force = true
+		} else {
+			args = append(args, part)
+		}
+	}
+	targetEditor := getTargetEditor(ws, args)
+	if targetEditor == nil {
+		return errors.New("错误：文件未找到或无活动文件")
+	}
+	if err := ws.ReloadFile(targetEditor, force); err != nil {
+		return fmt.Errorf("重新加载失败: %w", err)
+	}
+	fmt.Printf("已从磁盘重新加载: %s（可使用 undo 撤销）\n", ws.DisplayName(targetEditor.GetFilePath()))
+	return nil
+}
+
+// 列出上次遗留的交换文件
+func _listSwaps(ws *workspace.Workspace) {
+	swaps := ws.PendingSwaps()
+	if len(swaps) == 0 {
 		return
 	}
-	fmt.Printf("===== 日志内容（%s） =====\n", logFilePath)
+	fmt.Println("发现上次未正常退出时遗留的交换文件：")
+	for _, swap := range swaps {
+		fmt.Printf("  %s（%s，进程 %d）\n", ws.DisplayName(swap.FilePath), swap.SavedAt.Format("2006-01-02 15:04:05"), swap.PID)
+	}
+	fmt.Println("使用 recover <file> 恢复未保存的内容，或 discard <file> 丢弃")
+}
+
+// 处理recover：用交换文件恢复未保存的内容；无参数时列出待处理的交换文件
+func _recover(ws *workspace.Workspace, parts []string) error {
+	if len(parts) < 2 {
+		if len(ws.PendingSwaps()) == 0 {
+			fmt.Println("没有待恢复的交换文件")
+			return nil
+		}
+		_listSwaps(ws)
+		return nil
+	}
+	_editor, err := ws.RecoverSwap(parts[1], editor.EditorFactory)
+	if err != nil {
+		return fmt.Errorf("恢复失败: %w", err)
+	}
+	fmt.Printf("已从交换文件恢复: %s（已修改，可使用 undo 撤销恢复）\n", ws.DisplayName(_editor.GetFilePath()))
+	return nil
+}
+
+// 处理discard：丢弃交换文件
+func _discard(ws *workspace.Workspace, parts []string) error {
+	if len(parts) < 2 {
+		return errors.New("用法: discard <file>")
+	}
+	if err := ws.DiscardSwap(parts[1]); err != nil {
+		return fmt.Errorf("丢弃失败: %w", err)
+	}
+	fmt.Printf("已丢弃交换文件: %s\n", parts[1])
+	return nil
+}
+
+// 辅助函数：将指令中的文件参数转换为修订历史中的文件路径（相对工作区，为空时使用当前活动文件）
+func fileArgPath(ws *workspace.Workspace, name string) string {
+	if name == "" {
+		if activeEditor := ws.GetActiveEditor(); activeEditor != nil {
+			return ws.DisplayName(activeEditor.GetFilePath())
+		}
+		return ""
+	}
+	path, err := ws.ResolvePath(name)
+	if err != nil {
+		return ""
+	}
+	return ws.DisplayName(path)
+}
+
+// 处理revisions：列出指定文件/当前活动文件的修订历史
+func _revisions(ws *workspace.Workspace, parts []string) error {
+	name := ""
+	if len(parts) >= 2 {
+		name = parts[1]
+	}
+	path := fileArgPath(ws, name)
+	if path == "" {
+		return errors.New("错误：文件未找到或无活动文件")
+	}
+	revs, err := ws.Revisions().List(path)
+	if err != nil {
+		return fmt.Errorf("读取修订历史失败: %w", err)
+	}
+	if len(revs) == 0 {
+		fmt.Printf("文件 %s 没有修订历史\n", path)
+		return nil
+	}
+	fmt.Printf("===== 修订历史（%s） =====\n", path)
+	for _, rev := range revs {
+		fmt.Printf("%4d  %s  %6d 字节\n", rev.ID, rev.Time.Format("2006-01-02 15:04:05"), rev.Size)
+	}
+	return nil
+}
+
+// 处理show-rev：打印文件的某个历史版本
+func _showRev(ws *workspace.Workspace, parts []string) error {
+	if len(parts) < 3 {
+		return errors.New("用法: show-rev <file> <rev>")
+	}
+	id, err := strconv.Atoi(parts[2])
+	if err != nil {
+		return errors.New("修订号必须为整数")
+	}
+	content, err := ws.Revisions().Load(fileArgPath(ws, parts[1]), id)
+	if err != nil {
+		return fmt.Errorf("读取修订失败: %w", err)
+	}
 	fmt.Print(string(content))
+	if len(content) > 0 && content[len(content)-1] != '\n' {
+		fmt.Println()
+	}
+	return nil
+}
+
+// 处理diff-rev：比较当前活动文件（或指定文件）的两个修订，格式为 diff-rev [file] <a> <b>
+func _diffRev(ws *workspace.Workspace, parts []string) error {
+	args := parts[1:]
+	name := ""
+	if len(args) == 3 {
+		name, args = args[0], args[1:]
+	}
+	if len(args) != 2 {
+		return errors.New("用法: diff-rev [file] <a> <b>")
+	}
+	path := fileArgPath(ws, name)
+	if path == "" {
+		return errors.New("错误：文件未找到或无活动文件")
+	}
+	a, errA := strconv.Atoi(args[0])
+	b, errB := strconv.Atoi(args[1])
+	if errA != nil || errB != nil {
+		return errors.New("修订号必须为整数")
+	}
+	contentA, err := ws.Revisions().Load(path, a)
+	if err != nil {
+		return fmt.Errorf("读取修订失败: %w", err)
+	}
+	contentB, err := ws.Revisions().Load(path, b)
+	if err != nil {
+		return fmt.Errorf("读取修订失败: %w", err)
+	}
+
+	fmt.Printf("--- %s@%d\n+++ %s@%d\n", path, a, path, b)
+	for _, line := range textdiff.Diff(textdiff.SplitLines(string(contentA)), textdiff.SplitLines(string(contentB))) {
+		fmt.Printf("%c %s\n", line.Op, line.Text)
+	}
+	return nil
+}
+
+// 处理revert：将当前活动文件的缓冲区恢复为某个修订（可撤销的编辑，需 save 后才写入磁盘）
+func _revert(ws *workspace.Workspace, parts []string) error {
+	activeEditor := ws.GetActiveEditor()
+	if activeEditor == nil {
+		return errors.New("没有活动文件")
+	}
+	if len(parts) < 2 {
+		return errors.New("用法: revert <rev>")
+	}
+	id, err := strconv.Atoi(parts[1])
+	if err != nil {
+		return errors.New("修订号必须为整数")
+	}
+	content, err := ws.Revisions().Load(ws.DisplayName(activeEditor.GetFilePath()), id)
+	if err != nil {
+		return fmt.Errorf("读取修订失败: %w", err)
+	}
+	if err := activeEditor.SetContent(string(content)); err != nil {
+		return err
+	}
+	fmt.Printf("已将 %s 恢复为修订 %d（未保存，可使用 undo 撤销）\n", ws.DisplayName(activeEditor.GetFilePath()), id)
+	return nil
+}
+
+// 处理conflicts：列出当前活动文件中的合并冲突
+func _conflicts(ws *workspace.Workspace) error {
+	activeEditor := ws.GetActiveEditor()
+	if activeEditor == nil {
+		return errors.New("没有活动文件")
+	}
+	lines := textdiff.SplitLines(activeEditor.GetContent())
+	conflicts := textdiff.FindConflicts(lines)
+	if len(conflicts) == 0 {
+		fmt.Println("当前文件没有冲突")
+		return nil
+	}
+	for i, c := range conflicts {
+		fmt.Printf("冲突 %d: 第 %d-%d 行\n", i+1, c.Start+1, c.End+1)
+		for _, line := range c.Ours(lines) {
+			fmt.Printf("  ours   | %s\n", line)
+		}
+		for _, line := range c.Theirs(lines) {
+			fmt.Printf("  theirs | %s\n", line)
+		}
+	}
+	return nil
+}
+
+// 处理resolve：用缓冲区(ours)或磁盘(theirs)一侧的内容解决第 n 处冲突
+func _resolve(ws *workspace.Workspace, parts []string) error {
+	activeEditor := ws.GetActiveEditor()
+	if activeEditor == nil {
+		return errors.New("没有活动文件")
+	}
+	if len(parts) < 3 || (parts[1] != "ours" && parts[1] != "theirs") {
+		return errors.New("用法: resolve ours|theirs <n>")
+	}
+	lines := textdiff.SplitLines(activeEditor.GetContent())
+	conflicts := textdiff.FindConflicts(lines)
+	n, err := strconv.Atoi(parts[2])
+	if err != nil || n < 1 || n > len(conflicts) {
+		return fmt.Errorf("冲突编号无效，当前共有 %d 处冲突", len(conflicts))
+	}
+
+	// 通过可撤销的整体替换写回缓冲区
+	newLines := textdiff.ResolveConflict(lines, conflicts[n-1], parts[1] == "ours")
+	if err := activeEditor.SetContent(strings.Join(newLines, "\n")); err != nil {
+		return err
+	}
+	fmt.Printf("已使用 %s 解决冲突 %d，剩余 %d 处\n", parts[1], n, len(conflicts)-1)
+	return nil
+}
+
+// 处理session：命名会话的保存、打开、列出与删除
+func _session(ws *workspace.Workspace, parts []string) error {
+	usage := "用法: session save|open|delete <name> 或 session list"
+	if len(parts) < 2 {
+		if name := ws.CurrentSession(); name != "" {
+			fmt.Printf("当前会话: %s\n", name)
+		} else {
+			fmt.Println("当前未使用命名会话")
+		}
+		fmt.Println(usage)
+		return nil
+	}
+	if parts[1] == "list" {
+		sessions, err := ws.ListSessions()
+		if err != nil {
+			return fmt.Errorf("列出会话失败: %w", err)
+		}
+		if len(sessions) == 0 {
+			fmt.Println("没有已保存的会话")
+			return nil
+		}
+		for _, s := range sessions {
+			mark := " "
+			if s.Current {
+				mark = "*"
+			}
+			fmt.Printf("%s %s（%d 个文件，保存于 %s）\n", mark, s.Name, s.Files, s.ModTime.Format("2006-01-02 15:04:05"))
+		}
+		return nil
+	}
+	if len(parts) < 3 {
+		return errors.New(usage)
+	}
+
+	name := parts[2]
+	switch parts[1] {
+	case "save":
+		if err := ws.SaveSession(name); err != nil {
+			return fmt.Errorf("保存会话失败: %w", err)
+		}
+		fmt.Printf("已保存会话: %s\n", name)
+	case "open":
+		// 切换前逐个询问已修改的文件是否保存
+		if err := ws.ConfirmUnsaved(); err != nil {
+			return fmt.Errorf("未切换会话: %w", err)
+		}
+		report, err := ws.OpenSession(name, editor.EditorFactory, editor.BufferFactory)
+		if err != nil {
+			return fmt.Errorf("打开会话失败: %w", err)
+		}
+		fmt.Printf("已打开会话 %s：%s\n", name, report.Summary())
+	case "delete":
+		if err := ws.DeleteSession(name); err != nil {
+			return fmt.Errorf("删除会话失败: %w", err)
+		}
+		fmt.Printf("已删除会话: %s\n", name)
+	default:
+		return errors.New(usage)
+	}
+	return nil
+}
+
+// 处理save-as：将当前活动文件另存为新路径，之后编辑新文件
+func _saveAs(ws *workspace.Workspace, parts []string) error {
+	if len(parts) < 2 {
+		return errors.New("用法: save-as <path>")
+	}
+	activeEditor := ws.GetActiveEditor()
+	if activeEditor == nil {
+		return errors.New("没有活动文件")
+	}
+	oldPath := activeEditor.GetFilePath()
+	if err := ws.SaveAs(activeEditor, parts[1]); errors.Is(err, workspace.ErrCancelled) {
+		return errors.New("已取消保存")
+	} else if err != nil {
+		return fmt.Errorf("保存失败: %w", err)
+	}
+	fmt.Printf("已将 %s 另存为: %s\n", ws.DisplayName(oldPath), ws.DisplayName(activeEditor.GetFilePath()))
+	return nil
+}
+
+// 处理rename：重命名当前活动文件（移动磁盘上的文件，保留撤销历史与日志设置）
+func _rename(ws *workspace.Workspace, parts []string) error {
+	if len(parts) < 2 {
+		return errors.New("用法: rename <newpath>")
+	}
+	activeEditor := ws.GetActiveEditor()
+	if activeEditor == nil {
+		return errors.New("没有活动文件")
+	}
+	oldPath := activeEditor.GetFilePath()
+	if err := ws.Rename(activeEditor, parts[1]); err != nil {
+		return fmt.Errorf("重命名失败: %w", err)
+	}
+	fmt.Printf("已将 %s 重命名为: %s\n", ws.DisplayName(oldPath), ws.DisplayName(activeEditor.GetFilePath()))
+	return nil
+}
+
+// 处理back/forward：沿活动文件的切换历史后退、前进
+func _back(ws *workspace.Workspace) error {
+	_editor, err := ws.Back()
+	if err != nil {
+		return err
+	}
+	fmt.Printf("已切换到: %s\n", ws.DisplayName(_editor.GetFilePath()))
+	return nil
+}
+
+func _forward(ws *workspace.Workspace) error {
+	_editor, err := ws.Forward()
+	if err != nil {
+		return err
+	}
+	fmt.Printf("已切换到: %s\n", ws.DisplayName(_editor.GetFilePath()))
+	return nil
+}
+
+// 处理recent：列出最近打开的文件；recent <n> 打开第 n 个
+func _recent(ws *workspace.Workspace, parts []string) error {
+	files := ws.RecentFiles()
+	if len(parts) < 2 {
+		if len(files) == 0 {
+			fmt.Println("没有最近打开的文件")
+			return nil
+		}
+		for i, file := range files {
+			fmt.Printf("%2d  %s\n", i+1, file)
+		}
+		return nil
+	}
+	n, err := strconv.Atoi(parts[1])
+	if err != nil {
+		return errors.New("用法: recent [n]")
+	}
+	_editor, err := ws.OpenRecent(n, editor.EditorFactory)
+	if err != nil {
+		return fmt.Errorf("打开失败: %w", err)
+	}
+	fmt.Printf("已加载文件: %s\n", ws.DisplayName(_editor.GetFilePath()))
+	return nil
 }
 
 // 辅助函数：获取目标文件的编辑器（支持指定文件或当前活动文件）
 func getTargetEditor(ws *workspace.Workspace, parts []string) common.Editor {
 	if len(parts) >= 2 {
 		// 指定文件：从已打开的编辑器中查找
-		if editor, exists := ws.OpenEditors[parts[1]]; exists {
+		if editor, exists := ws.FindEditor(parts[1]); exists {
 			return editor
 		}
 		return nil
@@ -262,7 +974,7 @@ func getTargetEditor(ws *workspace.Workspace, parts []string) common.Editor {
 	}
 }
 
-func _Save(ws *workspace.Workspace, input string, debug bool, parts []string) {
+func _Save(ws *workspace.Workspace, input string, debug bool, parts []string) error {
 	if debug {
 		fmt.Printf("[DEBUG] 进入 save 命令处理，输入: %q，参数拆分: %v\n", input, parts)
 	}
@@ -277,24 +989,23 @@ func _Save(ws *workspace.Workspace, input string, debug bool, parts []string) {
 			if debug {
 				fmt.Println("[DEBUG] 未找到活动文件")
 			}
-			fmt.Println("没有活动文件可保存")
-			return
+			return errors.New("没有活动文件可保存")
 		}
 		if debug {
-			fmt.Printf("[DEBUG] 找到活动文件: %s，准备保存\n", activeEditor.GetFilePath())
+			fmt.Printf("[DEBUG] 找到活动文件: %s，准备保存\n", ws.DisplayName(activeEditor.GetFilePath()))
 		}
 		if err := ws.SaveFile(activeEditor); err != nil {
 			if debug {
 				fmt.Printf("[DEBUG] 活动文件保存失败: %v\n", err)
 			}
-			fmt.Printf("保存失败: %v\n", err)
+			return fmt.Errorf("保存失败: %w", err)
 		} else {
 			if debug {
-				fmt.Printf("[DEBUG] 活动文件保存成功: %s\n", activeEditor.GetFilePath())
+				fmt.Printf("[DEBUG] 活动文件保存成功: %s\n", ws.DisplayName(activeEditor.GetFilePath()))
 			}
-			fmt.Printf("已保存活动文件: %s\n", activeEditor.GetFilePath())
+			fmt.Printf("已保存活动文件: %s\n", ws.DisplayName(activeEditor.GetFilePath()))
 		}
-		return
+		return nil
 	}
 
 	// 2. 处理参数：保存指定文件或所有文件
@@ -313,8 +1024,7 @@ func _Save(ws *workspace.Workspace, input string, debug bool, parts []string) {
 			if debug {
 				fmt.Println("[DEBUG] 未找到任何打开的文件")
 			}
-			fmt.Println("没有打开的文件可保存")
-			return
+			return errors.New("没有打开的文件可保存")
 		}
 		if debug {
 			fmt.Printf("[DEBUG] 共找到 %d 个打开的文件，开始批量保存\n", len(openEditors))
@@ -322,17 +1032,17 @@ func _Save(ws *workspace.Workspace, input string, debug bool, parts []string) {
 		successCount := 0
 		for i, editor := range openEditors {
 			if debug {
-				fmt.Printf("[DEBUG] 正在保存第 %d 个文件: %s\n", i+1, editor.GetFilePath())
+				fmt.Printf("[DEBUG] 正在保存第 %d 个文件: %s\n", i+1, ws.DisplayName(editor.GetFilePath()))
 			}
 			if err := ws.SaveFile(editor); err != nil {
 				if debug {
 					fmt.Printf("[DEBUG] 第 %d 个文件保存失败: %v\n", i+1, err)
 				}
-				fmt.Printf("保存文件 %s 失败: %v\n", editor.GetFilePath(), err)
+				fmt.Printf("保存文件 %s 失败: %v\n", ws.DisplayName(editor.GetFilePath()), err)
 			} else {
 				successCount++
 				if debug {
-					fmt.Printf("[DEBUG] 第 %d 个文件保存成功: %s\n", i+1, editor.GetFilePath())
+					fmt.Printf("[DEBUG] 第 %d 个文件保存成功: %s\n", i+1, ws.DisplayName(editor.GetFilePath()))
 				}
 			}
 		}
@@ -340,6 +1050,9 @@ func _Save(ws *workspace.Workspace, input string, debug bool, parts []string) {
 			fmt.Printf("[DEBUG] 批量保存完成，成功 %d 个，失败 %d 个\n", successCount, len(openEditors)-successCount)
 		}
 		fmt.Printf("批量保存完成，成功 %d 个，失败 %d 个\n", successCount, len(openEditors)-successCount)
+		if successCount < len(openEditors) {
+			return fmt.Errorf("%d 个文件保存失败", len(openEditors)-successCount)
+		}
 
 	default:
 		// 保存指定文件（subCmd 为文件路径）
@@ -348,30 +1061,29 @@ func _Save(ws *workspace.Workspace, input string, debug bool, parts []string) {
 			fmt.Printf("[DEBUG] 处理指定文件保存，目标路径: %s\n", targetPath)
 		}
 		// 检查文件是否已打开
-		openEditors := ws.GetOpenEditors()
-		var targetEditor common.Editor
-		for _, editor := range openEditors {
-			if editor.GetFilePath() == targetPath {
-				targetEditor = editor
+		targetEditor, _ := ws.FindEditor(targetPath)
+		if targetEditor != nil && debug {
+			fmt.Printf("[DEBUG] 在已打开文件中找到目标文件: %s\n", targetPath)
+		}
+		if targetEditor == nil {
+			// 活动文件是尚未写入磁盘的新缓冲区（如 init 创建）时，参数视为保存路径
+			if activeEditor := ws.GetActiveEditor(); activeEditor != nil && activeEditor.IsNew() {
 				if debug {
-					fmt.Printf("[DEBUG] 在已打开文件中找到目标文件: %s\n", targetPath)
+					fmt.Printf("[DEBUG] 目标文件 %s 未打开，将新缓冲区另存为该路径\n", targetPath)
 				}
-				break
+				return _saveAs(ws, []string{"save-as", targetPath})
 			}
-		}
-		if targetEditor == nil {
 			if debug {
 				fmt.Printf("[DEBUG] 目标文件 %s 未打开\n", targetPath)
 			}
-			fmt.Printf("文件 %s 未打开，无法保存\n", targetPath)
-			return
+			return fmt.Errorf("文件 %s 未打开，无法保存", targetPath)
 		}
 		// 执行保存
 		if err := ws.SaveFile(targetEditor); err != nil {
 			if debug {
 				fmt.Printf("[DEBUG] 指定文件 %s 保存失败: %v\n", targetPath, err)
 			}
-			fmt.Printf("保存文件 %s 失败: %v\n", targetPath, err)
+			return fmt.Errorf("保存文件 %s 失败: %w", targetPath, err)
 		} else {
 			if debug {
 				fmt.Printf("[DEBUG] 指定文件 %s 保存成功\n", targetPath)
@@ -379,12 +1091,12 @@ func _Save(ws *workspace.Workspace, input string, debug bool, parts []string) {
 			fmt.Printf("已保存文件: %s\n", targetPath)
 		}
 	}
+	return nil
 }
 
-func _init(ws *workspace.Workspace, parts []string) {
+func _init(ws *workspace.Workspace, parts []string) error {
 	if len(parts) < 2 {
-		fmt.Println("用法: init <file> [with-log]")
-		return
+		return errors.New("用法: init <file> [with-log]")
 	}
 	fileName := parts[1]
 	withLog := len(parts) >= 3 && parts[2] == "with-log"
@@ -394,19 +1106,17 @@ func _init(ws *workspace.Workspace, parts []string) {
 	if withLog {
 		content = "# log\n" // 带日志标记的初始化内容
 	}
-	fmt.Printf("[%s %s %s]", parts[0], parts[1], parts[2])
-	// 创建未保存的缓冲区（使用 fileName 作为唯一标识）
-	_editor := editor.NewTextEditor(fileName, content, ws)
-	_editor.MarkAsModified(true) // 新缓冲区默认标记为已修改
-
-	// 添加到工作区的未保存缓冲区，并设为活动文件
-	ws.OpenEditors[_editor.GetFilePath()] = _editor
-	ws.SetActiveEditor(_editor)
+	// 创建只在内存中的新缓冲区（默认标记为已修改），并设为活动文件
+	_editor, err := ws.NewBuffer(fileName, content, editor.BufferFactory)
+	if err != nil {
+		return fmt.Errorf("创建失败: %w", err)
+	}
 
-	fmt.Printf("已创建新缓冲区: %s（未保存）\n", fileName)
+	fmt.Printf("已创建新缓冲区: %s（未保存）\n", ws.DisplayName(_editor.GetFilePath()))
 	if withLog {
 		fmt.Println("已自动添加日志标记 '# log'")
 	}
+	return nil
 }
 
 // generateDirectoryTree 生成指定目录的树形结构字符串
@@ -467,7 +1177,7 @@ func buildTree(root string, entries []os.DirEntry, prefix string, isLast bool, b
 	}
 }
 
-func _EditorList(ws *workspace.Workspace) {
+func _EditorList(ws *workspace.Workspace) error {
 	openEditors := ws.GetOpenEditors()
 	if len(openEditors) == 0 {
 		fmt.Printf("error:")
@@ -476,46 +1186,57 @@ func _EditorList(ws *workspace.Workspace) {
 	//j := len(openEditors)
 	//fmt.Printf("\n")
 	//modified := false //是否修改
+	// 按打开顺序列出，* 标记当前活动文件
 	for _, _editor := range openEditors {
 		if _editor.GetFilePath() != "" {
+			line := "  " + ws.DisplayName(_editor.GetFilePath())
+			if _editor == ws.GetActiveEditor() {
+				line = "* " + ws.DisplayName(_editor.GetFilePath())
+			}
 			if _editor.IsModified() {
-				fmt.Printf("%s [modified]\n", _editor.GetFilePath())
-			} else {
-				fmt.Printf("%s\n", _editor.GetFilePath())
+				line += " [modified]"
+			}
+			// 磁盘上的文件被其他程序修改、删除或重命名
+			if status := ws.DiskStatus(_editor); status != "" {
+				line += " [" + status + "]"
 			}
+			fmt.Println(line)
 		}
 	}
-
+	return nil
 }
 
-func _edit(ws *workspace.Workspace, parts []string) {
+func _edit(ws *workspace.Workspace, parts []string) error {
 	if len(parts) < 2 {
-		fmt.Printf("请指定文件:edit [file]\n")
-		return
+		return errors.New("请指定文件:edit [file]")
 	}
 	fileName := parts[1]
 	if fileName == "" {
-		fmt.Printf("请指定文件:edit [file]\n")
+		return errors.New("请指定文件:edit [file]")
+	} else if fileName == "-" {
+		// 切换到上一个使用的文件
+		_editor, err := ws.ActivatePrevious()
+		if err != nil {
+			return err
+		}
+		fmt.Printf("已切换到: %s\n", ws.DisplayName(_editor.GetFilePath()))
 	} else {
-		_, exists := ws.OpenEditors[fileName]
-		if exists {
-			ws.SetActiveEditor(ws.OpenEditors[fileName])
-		} else {
-			fmt.Printf("文件未打开: [file]\n")
+		_editor, exists := ws.FindEditor(fileName)
+		if !exists {
+			return errors.New("文件未打开: [file]")
 		}
+		ws.SetActiveEditor(_editor)
 	}
-
+	return nil
 }
 
-func _show(ws *workspace.Workspace, parts []string) {
+func _show(ws *workspace.Workspace, parts []string) error {
 	activeEditor := ws.GetActiveEditor()
 	if activeEditor == nil {
-		fmt.Println("没有活动文件")
-		return
+		return errors.New("没有活动文件")
 	}
 	if len(parts) == 1 {
-		fmt.Printf("指令格式错误:show [startLine:endLine]\n")
-		return
+		return errors.New("指令格式错误:show [startLine:endLine]")
 	}
 	startLine, endLine := 0, 0
 	if len(parts) > 0 {
@@ -523,26 +1244,22 @@ func _show(ws *workspace.Workspace, parts []string) {
 		// 按 ":" 分割字符串，处理 "start:end" 格式
 		segments := strings.Split(rangeStr, ":")
 		if len(segments) != 2 {
-			fmt.Println("参数格式错误，应为 show [startLine:endLine]")
-			return
+			return errors.New("参数格式错误，应为 show [startLine:endLine]")
 		}
 
 		// 解析起始行（必须为正整数）
 		s, err := strconv.Atoi(segments[0])
 		if err != nil || s < 1 {
-			fmt.Println("起始行必须为正整数")
-			return
+			return errors.New("起始行必须为正整数")
 		}
 
 		// 解析结束行（必须为正整数且不小于起始行）
 		e, err := strconv.Atoi(segments[1])
 		if err != nil || e < 1 {
-			fmt.Println("结束行必须为正整数")
-			return
+			return errors.New("结束行必须为正整数")
 		}
 		if e < s {
-			fmt.Println("结束行不能小于起始行")
-			return
+			return errors.New("结束行不能小于起始行")
 		}
 
 		startLine, endLine = s, e
@@ -552,21 +1269,20 @@ func _show(ws *workspace.Workspace, parts []string) {
 
 	// 调用编辑器的 Show 方法
 	//activeEditor.Show(startLine, endLine)
+	return nil
 }
 
-func _append(ws *workspace.Workspace, parts []string) {
+func _append(ws *workspace.Workspace, parts []string) error {
 	// 1. 校验活动文件是否存在
 	activeEditor := ws.GetActiveEditor()
 	if activeEditor == nil {
-		fmt.Println("错误：没有打开的文件，请先使用 load 命令加载文件")
-		return
+		return errors.New("错误：没有打开的文件，请先使用 load 命令加载文件")
 	}
 
 	// 2. 解析参数：实际参数是 parts[1:]（排除 parts[0] 的 "append"）
 	// 检查是否提供了参数（至少需要一个参数片段）
 	if len(parts) < 2 { // parts 长度至少为 2（["append", "参数"]）
-		fmt.Println("参数错误：请指定要追加的文本，格式为 append \"text\"")
-		return
+		return errors.New("参数错误：请指定要追加的文本，格式为 append \"text\"")
 	}
 
 	// 提取实际参数部分（排除命令名），并合并成完整字符串
@@ -575,31 +1291,30 @@ func _append(ws *workspace.Workspace, parts []string) {
 
 	// 3. 校验文本是否用双引号包裹
 	if len(textArg) < 2 || textArg[0] != '"' || textArg[len(textArg)-1] != '"' {
-		fmt.Println("参数错误：文本必须用双引号包裹，格式为 append \"text\"")
-		return
+		return errors.New("参数错误：文本必须用双引号包裹，格式为 append \"text\"")
 	}
 
 	// 4. 提取引号内的文本（去除首尾引号）
 	content := textArg[1 : len(textArg)-1]
 
 	// 5. 执行追加操作
-	activeEditor.Append(content)
+	if err := activeEditor.Append(content); err != nil {
+		return fmt.Errorf("追加失败: %w", err)
+	}
 	fmt.Printf("已在文件末尾追加一行：%s\n", content)
-
+	return nil
 }
 
-func _insert(ws *workspace.Workspace, parts []string) {
+func _insert(ws *workspace.Workspace, parts []string) error {
 	// 1. 校验活动文件是否存在
 	activeEditor := ws.GetActiveEditor()
 	if activeEditor == nil {
-		fmt.Println("错误：没有打开的文件，请先使用 load 命令加载文件")
-		return
+		return errors.New("错误：没有打开的文件，请先使用 load 命令加载文件")
 	}
 
 	// 2. 校验参数数量    // 格式要求：至少需要两个参数（位置 <line:col> 和带引号的文本）
 	if len(parts) < 3 {
-		fmt.Println("参数错误：格式为 insert <line:col> \"text\"（例如 insert 1:4 \"XYZ\"）")
-		return
+		return errors.New("参数错误：格式为 insert <line:col> \"text\"（例如 insert 1:4 \"XYZ\"）")
 	}
 
 	// 3. 解析位置参数 <line:col>
@@ -608,20 +1323,17 @@ func _insert(ws *workspace.Workspace, parts []string) {
 	// 按 ":" 分割行号和列号
 	posParts := strings.Split(posStr, ":")
 	if len(posParts) != 2 {
-		fmt.Println("参数错误：位置格式应为 line:col（例如 1:4）")
-		return
+		return errors.New("参数错误：位置格式应为 line:col（例如 1:4）")
 	}
 	// 转换行号为整数（1-based）
 	line, err := strconv.Atoi(posParts[0])
 	if err != nil || line < 1 {
-		fmt.Println("参数错误：行号必须为正整数")
-		return
+		return errors.New("参数错误：行号必须为正整数")
 	}
 	// 转换列号为整数（1-based）
 	col, err = strconv.Atoi(posParts[1])
 	if err != nil || col < 1 {
-		fmt.Println("参数错误：列号必须为正整数")
-		return
+		return errors.New("参数错误：列号必须为正整数")
 	}
 
 	// 4. 解析插入文本（合并后续参数，支持带空格和换行符）
@@ -630,29 +1342,29 @@ func _insert(ws *workspace.Workspace, parts []string) {
 	textArg := strings.Join(textParts, " ")
 	// 校验文本是否用双引号包裹
 	if len(textArg) < 2 || textArg[0] != '"' || textArg[len(textArg)-1] != '"' {
-		fmt.Println("参数错误：文本必须用双引号包裹（例如 \"XYZ\"）")
-		return
+		return errors.New("参数错误：文本必须用双引号包裹（例如 \"XYZ\"）")
 	}
 	// 提取引号内的文本（支持包含换行符 \n）
 	content := textArg[1 : len(textArg)-1]
 
 	// 5. 执行插入操作（调用编辑器的 Insert 方法）
-	activeEditor.Insert(line, col, content)
+	if err := activeEditor.Insert(line, col, content); err != nil {
+		return fmt.Errorf("插入失败: %w", err)
+	}
 	fmt.Printf("已在 %d:%d 位置插入文本：%s\n", line, col, content)
+	return nil
 }
 
-func _delete(ws *workspace.Workspace, parts []string) {
+func _delete(ws *workspace.Workspace, parts []string) error {
 	// 1. 校验活动文件是否存在
 	activeEditor := ws.GetActiveEditor()
 	if activeEditor == nil {
-		fmt.Println("错误：没有打开的文件，请先使用 load 命令加载文件")
-		return
+		return errors.New("错误：没有打开的文件，请先使用 load 命令加载文件")
 	}
 
 	// 2. 校验参数数量（必须包含 <line:col> 和 <len> 两个参数）
 	if len(parts) != 3 {
-		fmt.Println("参数错误：格式为 delete <line:col> <len>（例如 delete 1:7 5）")
-		return
+		return errors.New("参数错误：格式为 delete <line:col> <len>（例如 delete 1:7 5）")
 	}
 
 	// 3. 解析位置参数 <line:col>
@@ -660,48 +1372,45 @@ func _delete(ws *workspace.Workspace, parts []string) {
 	var line, col int
 	posParts := strings.Split(posStr, ":")
 	if len(posParts) != 2 {
-		fmt.Println("参数错误：位置格式应为 line:col（例如 1:7）")
-		return
+		return errors.New("参数错误：位置格式应为 line:col（例如 1:7）")
 	}
 	// 行号必须为正整数
 	line, err := strconv.Atoi(posParts[0])
 	if err != nil || line < 1 {
-		fmt.Println("参数错误：行号必须为正整数")
-		return
+		return errors.New("参数错误：行号必须为正整数")
 	}
 	// 列号必须为正整数
 	col, err = strconv.Atoi(posParts[1])
 	if err != nil || col < 1 {
-		fmt.Println("参数错误：列号必须为正整数")
-		return
+		return errors.New("参数错误：列号必须为正整数")
 	}
 
 	// 4. 解析删除长度 <len>
 	lenStr := parts[2]
 	length, err := strconv.Atoi(lenStr)
 	if err != nil || length < 1 {
-		fmt.Println("参数错误：删除长度必须为正整数")
-		return
+		return errors.New("参数错误：删除长度必须为正整数")
 	}
 
 	// 5. 执行删除操作（调用编辑器的 Delete 方法）
 	// 编辑器内部会处理：行号/列号越界、删除长度超出行尾等异常
-	activeEditor.Delete(line, col, length)
+	if err := activeEditor.Delete(line, col, length); err != nil {
+		return fmt.Errorf("删除失败: %w", err)
+	}
 	fmt.Printf("已从 %d:%d 位置删除 %d 个字符\n", line, col, length)
+	return nil
 }
 
-func _replace(ws *workspace.Workspace, parts []string) {
+func _replace(ws *workspace.Workspace, parts []string) error {
 	// 1. 校验活动文件是否存在
 	activeEditor := ws.GetActiveEditor()
 	if activeEditor == nil {
-		fmt.Println("错误：没有打开的文件，请先使用 load 命令加载文件")
-		return
+		return errors.New("错误：没有打开的文件，请先使用 load 命令加载文件")
 	}
 
 	// 2. 校验参数数量（必须包含 <line:col>、<len>、"text" 三个参数）
 	if len(parts) < 4 {
-		fmt.Println("参数错误：格式为 replace <line:col> <len> \"text\"（例如 replace 1:1 4 \"slow\"）")
-		return
+		return errors.New("参数错误：格式为 replace <line:col> <len> \"text\"（例如 replace 1:1 4 \"slow\"）")
 	}
 
 	// 3. 解析位置参数 <line:col>
@@ -710,28 +1419,24 @@ func _replace(ws *workspace.Workspace, parts []string) {
 	//posParts按 ":" 分割行号和列号
 	posParts := strings.Split(posStr, ":")
 	if len(posParts) != 2 {
-		fmt.Println("参数错误：位置格式应为 line:col（例如 1:1）")
-		return
+		return errors.New("参数错误：位置格式应为 line:col（例如 1:1）")
 	}
 	// 行号必须为正整数
 	line, err := strconv.Atoi(posParts[0])
 	if err != nil || line < 1 {
-		fmt.Println("参数错误：行号必须为正整数")
-		return
+		return errors.New("参数错误：行号必须为正整数")
 	}
 	// 列号必须为正整数
 	col, err = strconv.Atoi(posParts[1])
 	if err != nil || col < 1 {
-		fmt.Println("参数错误：列号必须为正整数")
-		return
+		return errors.New("参数错误：列号必须为正整数")
 	}
 
 	// 4. 解析删除删除长度 <len>
 	lenStr := parts[2]
 	length, err := strconv.Atoi(lenStr)
 	if err != nil || length < 1 {
-		fmt.Println("参数错误：删除长度必须为正整数")
-		return
+		return errors.New("参数错误：删除长度必须为正整数")
 	}
 
 	// 5. 解析替换文本（支持带空格和空字符串）
@@ -740,14 +1445,16 @@ func _replace(ws *workspace.Workspace, parts []string) {
 	textArg := strings.Join(textParts, " ")
 	// 校验文本是否用双引号包裹（空字符串需表示为 ""）
 	if len(textArg) < 2 || textArg[0] != '"' || textArg[len(textArg)-1] != '"' {
-		fmt.Println("参数错误：替换文本必须用双引号包裹（例如 \"slow\" 或 \"\"）")
-		return
+		return errors.New("参数错误：替换文本必须用双引号包裹（例如 \"slow\" 或 \"\"）")
 	}
 	// 提取引号内的文本（支持空字符串）
 	content := textArg[1 : len(textArg)-1]
 
 	// 6. 执行替换操作（调用编辑器的 Replace 方法）
 	// 编辑器内部会先执行 delete 再执行 insert，处理各类异常
-	activeEditor.Replace(line, col, length, content)
+	if err := activeEditor.Replace(line, col, length, content); err != nil {
+		return fmt.Errorf("替换失败: %w", err)
+	}
 	fmt.Printf("已从 %d:%d 位置替换 %d 个字符为：%s\n", line, col, length, content)
+	return nil
 }
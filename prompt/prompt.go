@@ -0,0 +1,148 @@
+package prompt
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// ------------------------------
+// 用户确认（是 / 否 / 取消）
+// ------------------------------
+
+// Answer 用户对确认提示的回答
+type Answer int
+
+const (
+	Yes    Answer = iota // 是（如：保存）
+	No                   // 否（如：丢弃修改）
+	Cancel               // 取消当前操作
+)
+
+// String 回答的描述
+func (a Answer) String() string {
+	switch a {
+	case Yes:
+		return "yes"
+	case No:
+		return "no"
+	}
+	return "cancel"
+}
+
+// ErrUnsavedChanges fail 策略下遇到需要确认的未保存修改
+var ErrUnsavedChanges = errors.New("存在未保存的修改")
+
+// ParseAnswer 解析用户输入：y/yes、n/no、c/cancel
+func ParseAnswer(s string) (Answer, error) {
+	switch strings.ToLower(strings.TrimSpace(s)) {
+	case "y", "yes":
+		return Yes, nil
+	case "n", "no":
+		return No, nil
+	case "c", "cancel":
+		return Cancel, nil
+	}
+	return Cancel, fmt.Errorf("无法识别的回答: %q", s)
+}
+
+// Prompter 向用户提出是/否/取消的问题
+type Prompter interface {
+	Ask(question string) (Answer, error)
+}
+
+// ------------------------------
+// 交互式：从输入中读取回答
+// ------------------------------
+
+type interactivePrompter struct {
+	in  *bufio.Scanner
+	out io.Writer
+}
+
+// NewInteractive 创建交互式确认，in 一般与交互循环共用标准输入
+func NewInteractive(in *bufio.Scanner, out io.Writer) Prompter {
+	return &interactivePrompter{in: in, out: out}
+}
+
+// Ask 输出问题并读取回答，输入无法识别时重新询问；输入结束时视为取消
+func (p *interactivePrompter) Ask(question string) (Answer, error) {
+	for {
+		fmt.Fprintf(p.out, "%s (y/n/c) ", question)
+		if !p.in.Scan() {
+			fmt.Fprintln(p.out)
+			if err := p.in.Err(); err != nil {
+				return Cancel, err
+			}
+			return Cancel, io.EOF
+		}
+		answer, err := ParseAnswer(p.in.Text())
+		if err == nil {
+			return answer, nil
+		}
+		fmt.Fprintln(p.out, "请输入 y（是）、n（否）或 c（取消）")
+	}
+}
+
+// ------------------------------
+// 非交互式：批处理与脚本使用的固定策略
+// ------------------------------
+
+type fixedPrompter struct {
+	answer Answer
+}
+
+// Always 对所有问题给出同一个回答
+func Always(answer Answer) Prompter {
+	return fixedPrompter{answer: answer}
+}
+
+func (p fixedPrompter) Ask(question string) (Answer, error) {
+	return p.answer, nil
+}
+
+type failPrompter struct{}
+
+// Fail 遇到任何问题都返回 ErrUnsavedChanges
+func Fail() Prompter {
+	return failPrompter{}
+}
+
+func (failPrompter) Ask(question string) (Answer, error) {
+	return Cancel, fmt.Errorf("%w（%s）", ErrUnsavedChanges, question)
+}
+
+type scriptedPrompter struct {
+	answers []Answer
+}
+
+// Scripted 依次给出预设的回答，用完后返回错误
+func Scripted(answers ...Answer) Prompter {
+	return &scriptedPrompter{answers: answers}
+}
+
+func (p *scriptedPrompter) Ask(question string) (Answer, error) {
+	if len(p.answers) == 0 {
+		return Cancel, fmt.Errorf("预设的回答已用完（%s）", question)
+	}
+	answer := p.answers[0]
+	p.answers = p.answers[1:]
+	return answer, nil
+}
+
+// ForPolicy 根据 -on-dirty 策略选择确认方式：prompt（交互询问）/ save / discard / fail
+func ForPolicy(policy string, interactive Prompter) (Prompter, error) {
+	switch policy {
+	case "", "prompt":
+		return interactive, nil
+	case "save":
+		return Always(Yes), nil
+	case "discard":
+		return Always(No), nil
+	case "fail":
+		return Fail(), nil
+	}
+	return interactive, errors.New("未知的未保存修改处理策略: " + policy + "（可选 prompt/save/discard/fail）")
+}
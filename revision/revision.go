@@ -0,0 +1,328 @@
+package revision
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// ------------------------------
+// 本地修订历史（内容寻址存储，位于工作区下的 .fdu 目录）
+// ------------------------------
+//
+// 目录结构：
+//   .fdu/objects/ab/cdef...      按内容 sha256 寻址的 gzip 压缩内容
+//   .fdu/revisions/<文件>.json    每个文件的修订索引
+
+// Revision 一次保存产生的修订
+type Revision struct {
+	ID   int       // 文件内递增的修订号
+	Hash string    // 内容的 sha256（十六进制）
+	Time time.Time // 保存时间
+	Size int       // 内容字节数
+}
+
+// PrunePolicy 旧修订的清理策略（为 0 表示不按该条件清理）
+type PrunePolicy struct {
+	MaxCount int           // 每个文件最多保留的修订数
+	MaxAge   time.Duration // 修订的最长保留时间
+}
+
+// fileIndex 单个文件的修订索引
+type fileIndex struct {
+	FilePath  string
+	NextID    int
+	Revisions []Revision
+}
+
+// Store 修订历史仓库
+type Store struct {
+	root   string
+	policy PrunePolicy
+}
+
+// NewStore 创建修订历史仓库，root 一般为 ./.fdu
+func NewStore(root string) *Store {
+	return &Store{root: root}
+}
+
+// SetPrunePolicy 设置旧修订的清理策略
+func (s *Store) SetPrunePolicy(policy PrunePolicy) {
+	s.policy = policy
+}
+
+// indexPath 返回文件修订索引的路径（文件路径转义为单个文件名）
+func (s *Store) indexPath(path string) string {
+	key := filepath.ToSlash(filepath.Clean(path))
+	return filepath.Join(s.root, "revisions", url.PathEscape(key)+".json")
+}
+
+// objectPath 返回内容对象的路径
+func (s *Store) objectPath(hash string) string {
+	return filepath.Join(s.root, "objects", hash[:2], hash[2:])
+}
+
+func (s *Store) readIndex(path string) (*fileIndex, error) {
+	index := &fileIndex{FilePath: filepath.ToSlash(filepath.Clean(path)), NextID: 1}
+	data, err := os.ReadFile(s.indexPath(path))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return index, nil
+		}
+		return nil, err
+	}
+	if err := json.Unmarshal(data, index); err != nil {
+		return nil, fmt.Errorf("修订索引已损坏 %s: %w", s.indexPath(path), err)
+	}
+	return index, nil
+}
+
+func (s *Store) writeIndex(path string, index *fileIndex) error {
+	data, err := json.MarshalIndent(index, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(s.indexPath(path)), 0755); err != nil {
+		return err
+	}
+	return writeFileAtomic(s.indexPath(path), data)
+}
+
+// writeFileAtomic 先写同目录下的临时文件再重命名，崩溃或多个实例同时写入时不会留下不完整的文件
+func writeFileAtomic(path string, data []byte) error {
+	f, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".tmp-*")
+	if err != nil {
+		return err
+	}
+	tmp := f.Name()
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		os.Remove(tmp)
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		os.Remove(tmp)
+		return err
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	if err := os.Chmod(tmp, 0644); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return nil
+}
+
+// writeObject 压缩写入内容对象
+// 已存在时只更新修改时间：对象在写入索引之前不被引用，回收时按修改时间保留（见 gcGracePeriod）
+func (s *Store) writeObject(hash string, content []byte) error {
+	objPath := s.objectPath(hash)
+	if _, err := os.Stat(objPath); err == nil {
+		now := time.Now()
+		return os.Chtimes(objPath, now, now)
+	}
+	if err := os.MkdirAll(filepath.Dir(objPath), 0755); err != nil {
+		return err
+	}
+
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	if _, err := zw.Write(content); err != nil {
+		return err
+	}
+	if err := zw.Close(); err != nil {
+		return err
+	}
+	return writeFileAtomic(objPath, buf.Bytes())
+}
+
+// readObject 读取并解压内容对象
+func (s *Store) readObject(hash string) ([]byte, error) {
+	f, err := os.Open(s.objectPath(hash))
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	zr, err := gzip.NewReader(f)
+	if err != nil {
+		return nil, err
+	}
+	defer zr.Close()
+	return io.ReadAll(zr)
+}
+
+// Save 为文件记录一次修订；内容与最新修订相同时不重复记录
+func (s *Store) Save(path string, content []byte) (Revision, error) {
+	index, err := s.readIndex(path)
+	if err != nil {
+		return Revision{}, err
+	}
+
+	sum := sha256.Sum256(content)
+	hash := hex.EncodeToString(sum[:])
+	if n := len(index.Revisions); n > 0 && index.Revisions[n-1].Hash == hash {
+		return index.Revisions[n-1], nil
+	}
+
+	if err := s.writeObject(hash, content); err != nil {
+		return Revision{}, err
+	}
+	rev := Revision{ID: index.NextID, Hash: hash, Time: time.Now(), Size: len(content)}
+	index.NextID++
+	index.Revisions = append(index.Revisions, rev)
+	if err := s.writeIndex(path, index); err != nil {
+		return Revision{}, err
+	}
+
+	if err := s.Prune(path); err != nil {
+		return rev, fmt.Errorf("清理旧修订失败: %w", err)
+	}
+	return rev, nil
+}
+
+// List 列出文件的所有修订（从旧到新）
+func (s *Store) List(path string) ([]Revision, error) {
+	index, err := s.readIndex(path)
+	if err != nil {
+		return nil, err
+	}
+	return index.Revisions, nil
+}
+
+// Load 读取文件指定修订的内容
+func (s *Store) Load(path string, id int) ([]byte, error) {
+	index, err := s.readIndex(path)
+	if err != nil {
+		return nil, err
+	}
+	for _, rev := range index.Revisions {
+		if rev.ID == id {
+			return s.readObject(rev.Hash)
+		}
+	}
+	return nil, fmt.Errorf("文件 %s 没有修订 %d", path, id)
+}
+
+// Rename 文件重命名后，将其修订历史移到新路径下（新路径已有修订历史时保持不变）
+func (s *Store) Rename(oldPath, newPath string) error {
+	index, err := s.readIndex(oldPath)
+	if err != nil {
+		return err
+	}
+	if len(index.Revisions) == 0 {
+		return nil
+	}
+	if _, err := os.Stat(s.indexPath(newPath)); err == nil {
+		return nil
+	}
+	index.FilePath = filepath.ToSlash(filepath.Clean(newPath))
+	if err := s.writeIndex(newPath, index); err != nil {
+		return err
+	}
+	return os.Remove(s.indexPath(oldPath))
+}
+
+// Prune 按清理策略删除文件的旧修订（始终保留最新一个），并回收不再被引用的内容对象
+func (s *Store) Prune(path string) error {
+	if s.policy.MaxCount <= 0 && s.policy.MaxAge <= 0 {
+		return nil
+	}
+	index, err := s.readIndex(path)
+	if err != nil {
+		return err
+	}
+
+	kept := index.Revisions
+	if s.policy.MaxCount > 0 && len(kept) > s.policy.MaxCount {
+		kept = kept[len(kept)-s.policy.MaxCount:]
+	}
+	if s.policy.MaxAge > 0 {
+		cutoff := time.Now().Add(-s.policy.MaxAge)
+		for len(kept) > 1 && kept[0].Time.Before(cutoff) {
+			kept = kept[1:]
+		}
+	}
+	if len(kept) == len(index.Revisions) {
+		return nil
+	}
+
+	index.Revisions = kept
+	if err := s.writeIndex(path, index); err != nil {
+		return err
+	}
+	return s.collectGarbage()
+}
+
+// gcGracePeriod 回收时保留最近写入的对象：其他实例可能刚写入对象、尚未写入引用它的索引
+const gcGracePeriod = 10 * time.Minute
+
+// collectGarbage 删除所有索引都不再引用、且修改时间早于 gcGracePeriod 的内容对象
+func (s *Store) collectGarbage() error {
+	referenced := make(map[string]bool)
+	indexFiles, err := filepath.Glob(filepath.Join(s.root, "revisions", "*.json"))
+	if err != nil {
+		return err
+	}
+	for _, indexFile := range indexFiles {
+		data, err := os.ReadFile(indexFile)
+		if err != nil {
+			return err
+		}
+		var index fileIndex
+		if err := json.Unmarshal(data, &index); err != nil {
+			// 索引损坏时无法确定引用关系，放弃回收以免误删
+			return fmt.Errorf("修订索引已损坏 %s: %w", indexFile, err)
+		}
+		for _, rev := range index.Revisions {
+			referenced[rev.Hash] = true
+		}
+	}
+
+	objectsDir := filepath.Join(s.root, "objects")
+	return filepath.WalkDir(objectsDir, func(p string, d os.DirEntry, err error) error {
+		if err != nil {
+			if errors.Is(err, os.ErrNotExist) {
+				return nil
+			}
+			return err
+		}
+		if d.IsDir() || strings.Contains(d.Name(), ".tmp") {
+			return nil
+		}
+		rel, err := filepath.Rel(objectsDir, p)
+		if err != nil {
+			return err
+		}
+		if hash := strings.ReplaceAll(filepath.ToSlash(rel), "/", ""); referenced[hash] {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			if errors.Is(err, os.ErrNotExist) {
+				return nil
+			}
+			return err
+		}
+		if time.Since(info.ModTime()) < gcGracePeriod {
+			return nil
+		}
+		return os.Remove(p)
+	})
+}
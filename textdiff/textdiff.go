@@ -0,0 +1,208 @@
+package textdiff
+
+import (
+	"strings"
+)
+
+// ------------------------------
+// 行级差异比较与三方合并
+// ------------------------------
+
+// 冲突标记：ours 为编辑器缓冲区内容，theirs 为磁盘上的内容
+const (
+	MarkerOurs   = "<<<<<<< buffer"
+	MarkerSep    = "======="
+	MarkerTheirs = ">>>>>>> disk"
+)
+
+// SplitLines 按换行符拆分文本（与 TextEditor 的行数组保持一致）
+func SplitLines(content string) []string {
+	return strings.Split(content, "\n")
+}
+
+// lcsMatches 计算 a、b 的最长公共子序列，返回 a 中每一行在 b 中匹配的下标（未匹配为 -1）
+func lcsMatches(a, b []string) []int {
+	n, m := len(a), len(b)
+	// dp[i][j] 表示 a[i:] 与 b[j:] 的 LCS 长度
+	dp := make([][]int, n+1)
+	for i := range dp {
+		dp[i] = make([]int, m+1)
+	}
+	for i := n - 1; i >= 0; i-- {
+		for j := m - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				dp[i][j] = dp[i+1][j+1] + 1
+			} else if dp[i+1][j] >= dp[i][j+1] {
+				dp[i][j] = dp[i+1][j]
+			} else {
+				dp[i][j] = dp[i][j+1]
+			}
+		}
+	}
+
+	matches := make([]int, n)
+	for i := range matches {
+		matches[i] = -1
+	}
+	i, j := 0, 0
+	for i < n && j < m {
+		if a[i] == b[j] {
+			matches[i] = j
+			i++
+			j++
+		} else if dp[i+1][j] >= dp[i][j+1] {
+			i++
+		} else {
+			j++
+		}
+	}
+	return matches
+}
+
+// DiffLine 差异中的一行
+type DiffLine struct {
+	Op   byte // ' ' 未变、'-' 仅在 a 中、'+' 仅在 b 中
+	Text string
+}
+
+// Diff 计算从 a 到 b 的行级差异
+func Diff(a, b []string) []DiffLine {
+	matches := lcsMatches(a, b)
+	var lines []DiffLine
+	j := 0
+	for i, line := range a {
+		if matches[i] < 0 {
+			lines = append(lines, DiffLine{Op: '-', Text: line})
+			continue
+		}
+		for ; j < matches[i]; j++ {
+			lines = append(lines, DiffLine{Op: '+', Text: b[j]})
+		}
+		lines = append(lines, DiffLine{Op: ' ', Text: line})
+		j++
+	}
+	for ; j < len(b); j++ {
+		lines = append(lines, DiffLine{Op: '+', Text: b[j]})
+	}
+	return lines
+}
+
+// MergeResult 三方合并结果
+type MergeResult struct {
+	Lines     []string // 合并后的行（冲突处已插入冲突标记）
+	Conflicts int      // 冲突数量
+}
+
+// Merge3 以 base 为共同祖先，对 ours（缓冲区）和 theirs（磁盘）做行级三方合并
+func Merge3(base, ours, theirs []string) MergeResult {
+	oursMatch := lcsMatches(base, ours)
+	theirsMatch := lcsMatches(base, theirs)
+
+	var result MergeResult
+	i, a, b := 0, 0, 0
+	for {
+		// 1. 三方一致的稳定行直接输出
+		for i < len(base) && oursMatch[i] == a && theirsMatch[i] == b {
+			result.Lines = append(result.Lines, base[i])
+			i++
+			a++
+			b++
+		}
+		if i >= len(base) && a >= len(ours) && b >= len(theirs) {
+			break
+		}
+
+		// 2. 找到下一个在三方中都存在的基准行，作为本段差异的结束位置
+		baseEnd, oursEnd, theirsEnd := len(base), len(ours), len(theirs)
+		for k := i; k < len(base); k++ {
+			if oursMatch[k] >= 0 && theirsMatch[k] >= 0 {
+				baseEnd, oursEnd, theirsEnd = k, oursMatch[k], theirsMatch[k]
+				break
+			}
+		}
+
+		// 3. 判断本段差异由哪一方修改
+		baseChunk := base[i:baseEnd]
+		oursChunk := ours[a:oursEnd]
+		theirsChunk := theirs[b:theirsEnd]
+		switch {
+		case equalLines(oursChunk, baseChunk):
+			result.Lines = append(result.Lines, theirsChunk...)
+		case equalLines(theirsChunk, baseChunk), equalLines(oursChunk, theirsChunk):
+			result.Lines = append(result.Lines, oursChunk...)
+		default:
+			result.Lines = append(result.Lines, MarkerOurs)
+			result.Lines = append(result.Lines, oursChunk...)
+			result.Lines = append(result.Lines, MarkerSep)
+			result.Lines = append(result.Lines, theirsChunk...)
+			result.Lines = append(result.Lines, MarkerTheirs)
+			result.Conflicts++
+		}
+		i, a, b = baseEnd, oursEnd, theirsEnd
+	}
+	return result
+}
+
+func equalLines(x, y []string) bool {
+	if len(x) != len(y) {
+		return false
+	}
+	for i := range x {
+		if x[i] != y[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// ------------------------------
+// 冲突标记的查找与解决
+// ------------------------------
+
+// Conflict 缓冲区中的一处冲突（均为 0-based 行下标）
+type Conflict struct {
+	Start int // <<<<<<< 所在行
+	Sep   int // ======= 所在行
+	End   int // >>>>>>> 所在行
+}
+
+// Ours 冲突中缓冲区一侧的内容
+func (c Conflict) Ours(lines []string) []string {
+	return lines[c.Start+1 : c.Sep]
+}
+
+// Theirs 冲突中磁盘一侧的内容
+func (c Conflict) Theirs(lines []string) []string {
+	return lines[c.Sep+1 : c.End]
+}
+
+// FindConflicts 扫描行数组中完整的冲突标记块
+func FindConflicts(lines []string) []Conflict {
+	var conflicts []Conflict
+	start, sep := -1, -1
+	for i, line := range lines {
+		switch {
+		case strings.HasPrefix(line, "<<<<<<<"):
+			start, sep = i, -1
+		case line == MarkerSep && start >= 0:
+			sep = i
+		case strings.HasPrefix(line, ">>>>>>>") && start >= 0 && sep >= 0:
+			conflicts = append(conflicts, Conflict{Start: start, Sep: sep, End: i})
+			start, sep = -1, -1
+		}
+	}
+	return conflicts
+}
+
+// ResolveConflict 用指定一侧的内容替换冲突块，返回新的行数组
+func ResolveConflict(lines []string, c Conflict, useOurs bool) []string {
+	kept := c.Theirs(lines)
+	if useOurs {
+		kept = c.Ours(lines)
+	}
+	newLines := make([]string, 0, len(lines))
+	newLines = append(newLines, lines[:c.Start]...)
+	newLines = append(newLines, kept...)
+	newLines = append(newLines, lines[c.End+1:]...)
+	return newLines
+}
@@ -0,0 +1,158 @@
+package workspace
+
+import (
+	"errors"
+	"fmt"
+	"lab1/common"
+	"net/url"
+	"os"
+	"path/filepath"
+)
+
+// ------------------------------
+// 备忘录中未保存缓冲区内容的持久化
+// ------------------------------
+
+// BufferMode 未保存缓冲区内容的保存方式
+type BufferMode int
+
+const (
+	BuffersEmbed   BufferMode = iota // 内容直接写入备忘录
+	BuffersSidecar                   // 内容写入旁路文件，备忘录中只记录文件路径
+	BuffersOff                       // 不保存内容，仅记录 modified 标记
+)
+
+// ParseBufferMode 解析命令行中的缓冲区保存方式：embed / sidecar / off
+func ParseBufferMode(s string) (BufferMode, error) {
+	switch s {
+	case "", "embed":
+		return BuffersEmbed, nil
+	case "sidecar":
+		return BuffersSidecar, nil
+	case "off":
+		return BuffersOff, nil
+	}
+	return BuffersEmbed, errors.New("未知的缓冲区保存方式: " + s + "（可选 embed/sidecar/off）")
+}
+
+// SetBufferMode 设置未保存缓冲区内容的保存方式，sidecar 模式的旁路文件存放在 dir 下
+func (w *Workspace) SetBufferMode(mode BufferMode, dir string) {
+	w.bufferMode = mode
+	w.bufferDir = dir
+}
+
+// BuffersPersisted 备忘录是否会保存未保存缓冲区的内容
+func (w *Workspace) BuffersPersisted() bool {
+	return w.bufferMode != BuffersOff
+}
+
+// sidecarDir 当前备忘录对应的旁路文件目录（不同备忘录互不影响）
+func (w *Workspace) sidecarDir() string {
+	return filepath.Join(w.bufferDir, url.PathEscape(filepath.Base(w.mementoPath)))
+}
+
+// sidecarPath 返回文件缓冲区内容的旁路文件路径
+func (w *Workspace) sidecarPath(path string) string {
+	return filepath.Join(w.sidecarDir(), url.PathEscape(filepath.ToSlash(w.DisplayName(path)))+".buf")
+}
+
+// sidecarBuffer 待写入旁路文件的缓冲区内容（生成备忘录时只在内存中记录，保存备忘录时由 WriteSidecars 写入）
+type sidecarBuffer struct {
+	state   int    // 对应 FileStates 中的下标
+	name    string // 文件的显示名称（写入失败时提示）
+	path    string // 旁路文件路径
+	content string
+	base    string
+}
+
+// saveBuffer 按保存方式将已修改缓冲区的内容记录到文件状态中（不做文件读写），index 为该状态在 FileStates 中的下标
+func (w *Workspace) saveBuffer(m *WorkspaceMemento, index int, state *FileState, editor common.Editor) {
+	content := editor.GetContent()
+	base := editor.GetBaseContent()
+	switch w.bufferMode {
+	case BuffersEmbed:
+		state.BufferContent = &content
+		state.BufferBase = &base
+	case BuffersSidecar:
+		state.BufferFile = w.sidecarPath(editor.GetFilePath())
+		m.sidecars = append(m.sidecars, sidecarBuffer{
+			state:   index,
+			name:    w.DisplayName(editor.GetFilePath()),
+			path:    state.BufferFile,
+			content: content,
+			base:    base,
+		})
+	}
+}
+
+// WriteSidecars 写入 CreateMemento 记录的缓冲区内容（写入备忘录之前调用，原有的旁路文件在备忘录写入后由 PruneSidecars 清理）
+// 单个缓冲区写入失败时给出警告，并从备忘录中去掉该旁路文件的记录
+func (w *Workspace) WriteSidecars(m *WorkspaceMemento) {
+	for _, buf := range m.sidecars {
+		if err := writeSidecar(buf); err != nil {
+			fmt.Printf("警告：保存缓冲区 %s 的内容失败: %v\n", buf.name, err)
+			m.FileStates[buf.state].BufferFile = ""
+		}
+	}
+}
+
+func writeSidecar(buf sidecarBuffer) error {
+	if err := os.MkdirAll(filepath.Dir(buf.path), 0755); err != nil {
+		return err
+	}
+	if err := writeFileAtomic(buf.path, []byte(buf.content)); err != nil {
+		return err
+	}
+	return writeFileAtomic(buf.path+".base", []byte(buf.base))
+}
+
+// loadBuffer 读取文件状态中记录的缓冲区内容，没有记录时返回 ok=false
+func loadBuffer(state FileState) (content, base string, ok bool, err error) {
+	if state.BufferContent != nil {
+		content = *state.BufferContent
+		if state.BufferBase != nil {
+			base = *state.BufferBase
+		}
+		return content, base, true, nil
+	}
+	if state.BufferFile == "" {
+		return "", "", false, nil
+	}
+	data, err := os.ReadFile(state.BufferFile)
+	if err != nil {
+		return "", "", false, err
+	}
+	baseData, err := os.ReadFile(state.BufferFile + ".base")
+	if err != nil && !os.IsNotExist(err) {
+		return "", "", false, err
+	}
+	return string(data), string(baseData), true, nil
+}
+
+// PruneSidecars 删除当前备忘录目录下不再被 m 引用的旁路文件（备忘录写入成功之后调用，
+// 写入失败时旧备忘录引用的旁路文件仍然完好）
+func (w *Workspace) PruneSidecars(m *WorkspaceMemento) {
+	if w.bufferDir == "" {
+		return
+	}
+	referenced := make(map[string]bool)
+	for _, state := range m.FileStates {
+		if state.BufferFile != "" {
+			name := filepath.Base(filepath.FromSlash(state.BufferFile))
+			referenced[name] = true
+			referenced[name+".base"] = true
+		}
+	}
+	entries, err := os.ReadDir(w.sidecarDir())
+	if err != nil {
+		return
+	}
+	for _, entry := range entries {
+		if entry.IsDir() || referenced[entry.Name()] {
+			continue
+		}
+		if err := os.Remove(filepath.Join(w.sidecarDir(), entry.Name())); err != nil {
+			fmt.Printf("警告：删除过期的旁路文件失败 %s: %v\n", entry.Name(), err)
+		}
+	}
+}
@@ -0,0 +1,81 @@
+package workspace
+
+import (
+	"errors"
+	"fmt"
+	"lab1/common"
+	"lab1/prompt"
+	"os"
+	"sort"
+)
+
+// ------------------------------
+// 已修改文件的确认（关闭、退出、切换会话前）
+// ------------------------------
+
+// ErrCancelled 用户取消了关闭、退出等操作
+var ErrCancelled = errors.New("操作已取消")
+
+// SetPrompter 设置已修改文件的确认方式（交互询问或批处理策略）
+func (w *Workspace) SetPrompter(p prompt.Prompter) {
+	w.prompter = p
+}
+
+// SetOverwritePrompter 设置另存为覆盖已有文件时的确认方式（未设置时一律不覆盖）
+func (w *Workspace) SetOverwritePrompter(p prompt.Prompter) {
+	w.overwrite = p
+}
+
+// confirmDirty 询问已修改的文件是否保存：是则保存，否则不做处理，取消时返回 ErrCancelled
+func (w *Workspace) confirmDirty(editor common.Editor) error {
+	if !editor.IsModified() || editor.IsReadOnly() {
+		return nil
+	}
+	answer, err := w.prompter.Ask(fmt.Sprintf("文件 %s 已修改，是否保存?", w.DisplayName(editor.GetFilePath())))
+	if err != nil {
+		return err
+	}
+	switch answer {
+	case prompt.Yes:
+		return w.SaveFile(editor)
+	case prompt.Cancel:
+		return ErrCancelled
+	}
+	return nil
+}
+
+// ConfirmUnsaved 逐个询问所有已修改的文件（退出、切换会话前调用）
+// 选择保存的写入磁盘；选择不保存的不写入磁盘：备忘录会记录缓冲区内容时（-memento-buffers 不为 off）原样保留，
+// 由随后写入的备忘录持久化，否则丢弃修改：恢复为磁盘内容，从未保存过的缓冲区直接关闭
+// 任一文件取消或保存失败时立即返回错误，已处理的文件保持处理后的状态
+func (w *Workspace) ConfirmUnsaved() error {
+	paths := make([]string, 0, len(w.OpenEditors))
+	for path := range w.OpenEditors {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+
+	for _, path := range paths {
+		editor := w.OpenEditors[path]
+		if err := w.confirmDirty(editor); err != nil {
+			return err
+		}
+		if editor.IsModified() && !editor.IsReadOnly() && !w.BuffersPersisted() {
+			w.discardChanges(path, editor)
+		}
+	}
+	return nil
+}
+
+// discardChanges 丢弃编辑器中未保存的修改
+func (w *Workspace) discardChanges(path string, editor common.Editor) {
+	if _, err := os.Stat(path); editor.IsNew() || os.IsNotExist(err) {
+		w.removeEditor(path)
+		return
+	}
+	if err := w.ReloadFile(editor, true); err != nil {
+		fmt.Printf("警告：丢弃 %s 的修改失败: %v\n", w.DisplayName(path), err)
+		return
+	}
+	w.removeSwapFile(path)
+}
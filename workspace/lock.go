@@ -0,0 +1,265 @@
+package workspace
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"lab1/common"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// ------------------------------
+// 跨进程的建议锁（防止两个编辑器实例互相覆盖）
+// ------------------------------
+
+// LockInfo 锁文件内容：持有锁的进程信息
+type LockInfo struct {
+	PID       int
+	Host      string
+	StartTime time.Time
+}
+
+// processStart 本进程的启动时间，写入锁文件；与系统记录的进程启动时间一致，用于识别被复用的 PID
+var processStart = selfStartTime()
+
+// selfStartTime 系统记录的本进程启动时间，无法获取时使用当前时间
+func selfStartTime() time.Time {
+	if start, ok := processStartTime(os.Getpid()); ok {
+		return start
+	}
+	return time.Now()
+}
+
+// startTimeSlack 比较进程启动时间时允许的误差（系统记录的精度有限）
+const startTimeSlack = 2 * time.Second
+
+// lockPath 返回文件对应的锁文件路径：同目录下的 .文件名.lock
+func lockPath(path string) string {
+	return filepath.Join(filepath.Dir(path), "."+filepath.Base(path)+".lock")
+}
+
+// currentLockInfo 本进程的锁信息
+func currentLockInfo() LockInfo {
+	host, _ := os.Hostname()
+	return LockInfo{PID: os.Getpid(), Host: host, StartTime: processStart}
+}
+
+// String 锁持有者的描述
+func (l LockInfo) String() string {
+	return fmt.Sprintf("进程 %d@%s，启动于 %s", l.PID, l.Host, l.StartTime.Format("2006-01-02 15:04:05"))
+}
+
+// isOurs 判断锁是否由本进程持有
+func (l LockInfo) isOurs() bool {
+	self := currentLockInfo()
+	return l.PID == self.PID && l.Host == self.Host
+}
+
+// alive 判断持有者是否仍在运行：其他主机上的进程无法探测，视为存活；
+// 同一主机上进程存在且启动时间与记录一致才算存活（PID 被新进程复用时启动时间不同）
+func (l LockInfo) alive() bool {
+	if l.Host != currentLockInfo().Host {
+		return true
+	}
+	if !processAlive(l.PID) {
+		return false
+	}
+	if l.StartTime.IsZero() {
+		return true
+	}
+	if start, ok := processStartTime(l.PID); ok {
+		diff := start.Sub(l.StartTime)
+		return diff < startTimeSlack && diff > -startTimeSlack
+	}
+	return true
+}
+
+// readLock 读取锁文件
+func readLock(path string) (LockInfo, error) {
+	var info LockInfo
+	data, err := os.ReadFile(lockPath(path))
+	if err != nil {
+		return info, err
+	}
+	err = json.Unmarshal(data, &info)
+	return info, err
+}
+
+// acquireLock 尝试获取文件的锁
+// 成功或本进程已持有时返回 nil；被其他存活的进程持有时返回持有者信息
+// 持有者进程已不存在或 PID 已被其他进程复用（同一主机）、锁文件损坏时视为失效锁，由 takeOverLock 原子地接管
+func acquireLock(path string) (*LockInfo, error) {
+	self := currentLockInfo()
+	data, err := json.Marshal(self)
+	if err != nil {
+		return nil, err
+	}
+
+	for attempt := 0; attempt < 2; attempt++ {
+		f, err := os.OpenFile(lockPath(path), os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0644)
+		if err == nil {
+			_, err = f.Write(data)
+			if closeErr := f.Close(); err == nil {
+				err = closeErr
+			}
+			return nil, err
+		}
+		if !os.IsExist(err) {
+			return nil, err
+		}
+
+		stale, err := os.ReadFile(lockPath(path))
+		if os.IsNotExist(err) {
+			continue // 持有者刚刚释放了锁
+		}
+		if err != nil {
+			return nil, err
+		}
+		var holder LockInfo
+		if err := json.Unmarshal(stale, &holder); err == nil {
+			if holder.isOurs() {
+				return nil, nil
+			}
+			if holder.alive() {
+				return &holder, nil
+			}
+			fmt.Printf("已清除失效的锁: %s（%s 已不存在）\n", lockPath(path), holder)
+		} else {
+			fmt.Printf("已清除损坏的锁: %s\n", lockPath(path))
+		}
+		owner, err := takeOverLock(path, stale, data)
+		if errors.Is(err, errLockChanged) {
+			continue // 重新检查新的持有者
+		}
+		return owner, err
+	}
+	return nil, fmt.Errorf("无法获取锁: %s", lockPath(path))
+}
+
+// errLockChanged 接管失效锁前锁文件已被其他实例替换或释放
+var errLockChanged = errors.New("锁文件已变化")
+
+// takeOverLock 用本进程的锁替换内容为 stale 的失效锁
+// 先写临时文件再 rename 覆盖锁文件（不存在删除后重新创建之间的空档），替换后读回确认：
+// 多个实例同时接管时只有最后一次 rename 生效，其余实例读到的是获胜者的锁
+func takeOverLock(path string, stale, data []byte) (*LockInfo, error) {
+	f, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".lock-*")
+	if err != nil {
+		return nil, err
+	}
+	tmp := f.Name()
+	defer os.Remove(tmp)
+	_, err = f.Write(data)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// 锁文件在检查之后已被其他实例接管或释放时不再覆盖
+	if current, err := os.ReadFile(lockPath(path)); err != nil || !bytes.Equal(current, stale) {
+		return nil, errLockChanged
+	}
+	if err := os.Rename(tmp, lockPath(path)); err != nil {
+		return nil, err
+	}
+
+	holder, err := readLock(path)
+	if err != nil {
+		return nil, err
+	}
+	if holder.isOurs() {
+		return nil, nil
+	}
+	return &holder, nil
+}
+
+// releaseLock 释放本进程持有的锁（其他进程的锁不做处理）
+func releaseLock(path string) {
+	holder, err := readLock(path)
+	if err != nil || !holder.isOurs() {
+		return
+	}
+	if err := os.Remove(lockPath(path)); err != nil && !os.IsNotExist(err) {
+		fmt.Printf("警告：释放锁失败 %s: %v\n", lockPath(path), err)
+	}
+}
+
+// lockEditor 为新打开的编辑器加锁；文件正被其他实例编辑时以只读方式打开
+// 尚未写入磁盘的新缓冲区不加锁（不在磁盘上留下任何文件），首次保存后再加锁
+func (w *Workspace) lockEditor(editor common.Editor) {
+	if editor.IsNew() {
+		return
+	}
+	path := editor.GetFilePath()
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		fmt.Printf("警告：无法为 %s 加锁: %v\n", w.DisplayName(path), err)
+		return
+	}
+	holder, err := acquireLock(path)
+	if err != nil {
+		fmt.Printf("警告：无法为 %s 加锁: %v\n", w.DisplayName(path), err)
+		return
+	}
+	if holder != nil {
+		editor.SetReadOnly(true)
+		fmt.Printf("警告：文件 %s 正被另一个实例编辑（%s），已以只读方式打开\n", w.DisplayName(path), holder)
+		return
+	}
+	w.fileLocks[path] = true
+	w.rotateLogs(path)
+}
+
+// rotateLogs 本会话首次为文件加锁、且尚未为它发出任何事件时，按轮转策略轮转其文本与 JSONL 日志
+// 只轮转本实例持有锁的文件，不会移走其他实例正在写入的日志；此后不再轮转，一个会话的日志不会被拆开
+func (w *Workspace) rotateLogs(path string) {
+	if w.logged[path] {
+		return
+	}
+	w.logged[path] = true
+	if err := w.LogResolver().Rotate(path); err != nil {
+		fmt.Printf("警告：%s 的日志轮转失败: %v\n", w.DisplayName(path), err)
+	}
+}
+
+// unlockEditor 关闭文件时释放锁
+func (w *Workspace) unlockEditor(path string) {
+	if w.fileLocks[path] {
+		releaseLock(path)
+		delete(w.fileLocks, path)
+	}
+}
+
+// AcquireStateLock 获取工作区状态文件的锁；被其他实例持有时本实例不会写入状态文件
+func (w *Workspace) AcquireStateLock() {
+	holder, err := acquireLock(w.mementoPath)
+	if err != nil {
+		fmt.Printf("警告：无法为工作区状态加锁: %v\n", err)
+		return
+	}
+	if holder != nil {
+		w.stateLockHolder = holder
+		fmt.Printf("警告：工作区状态正被另一个实例使用（%s），退出时将不保存工作区状态\n", holder)
+		return
+	}
+	w.stateLockHolder = nil
+}
+
+// StateLockedByOther 工作区状态文件是否被其他实例锁定
+func (w *Workspace) StateLockedByOther() bool {
+	return w.stateLockHolder != nil
+}
+
+// ReleaseLocks 释放本实例持有的所有锁（退出时调用）
+func (w *Workspace) ReleaseLocks() {
+	for path := range w.fileLocks {
+		w.unlockEditor(path)
+	}
+	if w.stateLockHolder == nil {
+		releaseLock(w.mementoPath)
+	}
+}
@@ -0,0 +1,175 @@
+package workspace
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// ------------------------------
+// 备忘录格式版本与迁移
+// ------------------------------
+
+// CurrentMementoVersion 当前备忘录格式版本
+// 版本 0：早期格式，无版本号，路径为平台相关写法（如 Windows 下的 files\apple.txt）
+// 版本 1：增加版本号，路径统一为相对工作区的正斜杠路径
+const CurrentMementoVersion = 1
+
+// mementoMigrations[i] 将版本 i 的备忘录（原始 JSON）升级到版本 i+1
+var mementoMigrations = []func(raw map[string]interface{}) error{
+	migrateV0ToV1,
+}
+
+// migrateV0ToV1 将所有路径中的反斜杠统一为正斜杠，并去掉开头的 ./
+func migrateV0ToV1(raw map[string]interface{}) error {
+	normalize := func(v interface{}) interface{} {
+		s, ok := v.(string)
+		if !ok {
+			return v
+		}
+		return normalizeLegacyPath(s)
+	}
+	normalizeList := func(v interface{}) {
+		if list, ok := v.([]interface{}); ok {
+			for i := range list {
+				list[i] = normalize(list[i])
+			}
+		}
+	}
+
+	normalizeList(raw["OpenedFilePaths"])
+	normalizeList(raw["ModifiedFilePaths"])
+	if v, ok := raw["ActiveFilePath"]; ok {
+		raw["ActiveFilePath"] = normalize(v)
+	}
+	if states, ok := raw["FileStates"].([]interface{}); ok {
+		for _, s := range states {
+			if state, ok := s.(map[string]interface{}); ok {
+				state["FilePath"] = normalize(state["FilePath"])
+				if v, ok := state["BufferFile"]; ok {
+					state["BufferFile"] = normalize(v)
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// normalizeLegacyPath 将早期格式的路径转换为正斜杠写法
+func normalizeLegacyPath(path string) string {
+	path = strings.ReplaceAll(path, "\\", "/")
+	for strings.HasPrefix(path, "./") {
+		path = strings.TrimPrefix(path, "./")
+	}
+	return path
+}
+
+// decodeMemento 解析备忘录，按需逐级迁移到当前版本
+func decodeMemento(data []byte) (*WorkspaceMemento, error) {
+	var raw map[string]interface{}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return nil, err
+	}
+	if raw == nil {
+		return nil, errors.New("备忘录内容为空")
+	}
+
+	version := 0
+	if v, ok := raw["Version"]; ok {
+		f, ok := v.(float64)
+		if !ok || f < 0 || f != float64(int(f)) {
+			return nil, fmt.Errorf("无效的备忘录版本: %v", v)
+		}
+		version = int(f)
+	}
+	if version > CurrentMementoVersion {
+		return nil, fmt.Errorf("备忘录版本 %d 高于当前支持的版本 %d", version, CurrentMementoVersion)
+	}
+	for ; version < CurrentMementoVersion; version++ {
+		if err := mementoMigrations[version](raw); err != nil {
+			return nil, fmt.Errorf("备忘录从版本 %d 迁移失败: %w", version, err)
+		}
+		raw["Version"] = version + 1
+	}
+
+	migrated, err := json.Marshal(raw)
+	if err != nil {
+		return nil, err
+	}
+	var memento WorkspaceMemento
+	if err := json.Unmarshal(migrated, &memento); err != nil {
+		return nil, err
+	}
+	return &memento, nil
+}
+
+// moveAsideCorrupt 将无法解析的状态文件改名保留，避免被覆盖，返回新路径
+func moveAsideCorrupt(path string) (string, error) {
+	corruptPath := path + ".corrupt-" + time.Now().Format("20060102-150405")
+	if err := os.Rename(path, corruptPath); err != nil {
+		return "", err
+	}
+	return corruptPath, nil
+}
+
+// ------------------------------
+// 工作区相对路径（备忘录中保存的可移植写法）
+// ------------------------------
+
+// toPortablePath 将内存中的规范路径转换为相对工作区的正斜杠路径（工作区外的文件保留绝对路径）
+func (w *Workspace) toPortablePath(path string) string {
+	if path == "" {
+		return ""
+	}
+	return filepath.ToSlash(filepath.Clean(w.DisplayName(path)))
+}
+
+// fromPortablePath 将备忘录中的正斜杠路径转换为当前平台的规范路径
+func (w *Workspace) fromPortablePath(path string) string {
+	if path == "" {
+		return ""
+	}
+	path = filepath.FromSlash(path)
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(w.baseDir, path)
+	}
+	if canonical, err := canonicalPath(path); err == nil {
+		return canonical
+	}
+	return path
+}
+
+// toPortable 转换备忘录中的所有路径为可移植写法（保存前调用）
+func (w *Workspace) toPortable(m *WorkspaceMemento) {
+	m.Version = CurrentMementoVersion
+	for i := range m.OpenedFilePaths {
+		m.OpenedFilePaths[i] = w.toPortablePath(m.OpenedFilePaths[i])
+	}
+	for i := range m.ModifiedFilePaths {
+		m.ModifiedFilePaths[i] = w.toPortablePath(m.ModifiedFilePaths[i])
+	}
+	m.ActiveFilePath = w.toPortablePath(m.ActiveFilePath)
+	for i := range m.FileStates {
+		m.FileStates[i].FilePath = w.toPortablePath(m.FileStates[i].FilePath)
+		m.FileStates[i].BufferFile = w.toPortablePath(m.FileStates[i].BufferFile)
+	}
+}
+
+// fromPortable 转换备忘录中的所有路径为当前平台写法（恢复前调用）
+func (w *Workspace) fromPortable(m *WorkspaceMemento) {
+	for i := range m.OpenedFilePaths {
+		m.OpenedFilePaths[i] = w.fromPortablePath(m.OpenedFilePaths[i])
+	}
+	for i := range m.ModifiedFilePaths {
+		m.ModifiedFilePaths[i] = w.fromPortablePath(m.ModifiedFilePaths[i])
+	}
+	m.ActiveFilePath = w.fromPortablePath(m.ActiveFilePath)
+	for i := range m.FileStates {
+		m.FileStates[i].FilePath = w.fromPortablePath(m.FileStates[i].FilePath)
+		m.FileStates[i].BufferFile = w.fromPortablePath(m.FileStates[i].BufferFile)
+	}
+}
@@ -0,0 +1,210 @@
+package workspace
+
+import (
+	"errors"
+	"fmt"
+	"lab1/common"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// ------------------------------
+// 打开顺序、最近使用顺序与导航历史
+// ------------------------------
+
+// removePath 从路径列表中删除指定路径
+func removePath(list []string, path string) []string {
+	kept := list[:0]
+	for _, p := range list {
+		if p != path {
+			kept = append(kept, p)
+		}
+	}
+	return kept
+}
+
+// activate 切换活动编辑器并更新最近使用顺序；record 为 true 时记入 back/forward 导航历史
+// 活动文件发生变化时通知观察者
+func (w *Workspace) activate(editor common.Editor, record bool) {
+	prev := w.setActive(editor, record)
+	if editor != nil && prev != editor.GetFilePath() {
+		w.notifyEditor(editor, common.EventActiveChanged, "Edit", "Edit "+editor.GetFilePath(),
+			common.ActivePayload{From: prev, To: editor.GetFilePath()})
+	}
+}
+
+// setActive 切换活动编辑器并更新最近使用顺序、导航历史（不通知观察者，恢复工作区时使用），返回原活动文件的路径
+func (w *Workspace) setActive(editor common.Editor, record bool) string {
+	prev := ""
+	if w.activeEditor != nil {
+		prev = w.activeEditor.GetFilePath()
+	}
+	if editor == nil {
+		w.activeEditor = nil
+		return prev
+	}
+	path := editor.GetFilePath()
+	if prev != "" && prev != path && record {
+		w.backStack = append(w.backStack, prev)
+		w.forwardStack = nil
+	}
+	w.activeEditor = editor
+
+	w.mru = append([]string{path}, removePath(w.mru, path)...)
+	for _, p := range w.openOrder {
+		if p == path {
+			return prev
+		}
+	}
+	w.openOrder = append(w.openOrder, path)
+	return prev
+}
+
+// forgetEditor 关闭文件时从打开顺序、最近使用顺序和导航历史中移除
+func (w *Workspace) forgetEditor(path string) {
+	w.openOrder = removePath(w.openOrder, path)
+	w.mru = removePath(w.mru, path)
+	w.backStack = removePath(w.backStack, path)
+	w.forwardStack = removePath(w.forwardStack, path)
+}
+
+// mostRecentEditor 最近使用过且仍打开的编辑器（关闭活动文件后以它为新的活动文件）
+func (w *Workspace) mostRecentEditor() common.Editor {
+	for _, path := range w.mru {
+		if editor, ok := w.OpenEditors[path]; ok {
+			return editor
+		}
+	}
+	for _, path := range w.orderedPaths() {
+		return w.OpenEditors[path]
+	}
+	return nil
+}
+
+// orderedPaths 按打开顺序返回所有已打开文件的路径（未记录顺序的按名称排在最后）
+func (w *Workspace) orderedPaths() []string {
+	paths := make([]string, 0, len(w.OpenEditors))
+	seen := make(map[string]bool, len(w.OpenEditors))
+	for _, path := range w.openOrder {
+		if _, ok := w.OpenEditors[path]; ok && !seen[path] {
+			paths = append(paths, path)
+			seen[path] = true
+		}
+	}
+	var rest []string
+	for path := range w.OpenEditors {
+		if !seen[path] {
+			rest = append(rest, path)
+		}
+	}
+	sort.Strings(rest)
+	return append(paths, rest...)
+}
+
+// ActivatePrevious 切换到上一个使用的编辑器（edit -）
+func (w *Workspace) ActivatePrevious() (common.Editor, error) {
+	for _, path := range w.mru {
+		if w.activeEditor != nil && path == w.activeEditor.GetFilePath() {
+			continue
+		}
+		if editor, ok := w.OpenEditors[path]; ok {
+			w.activate(editor, true)
+			return editor, nil
+		}
+	}
+	return nil, errors.New("没有上一个使用的文件")
+}
+
+// Back 沿导航历史后退到上一个活动文件（已关闭的文件跳过）
+func (w *Workspace) Back() (common.Editor, error) {
+	editor, ok := w.navigate(&w.backStack, &w.forwardStack)
+	if !ok {
+		return nil, errors.New("没有可后退的文件")
+	}
+	return editor, nil
+}
+
+// Forward 沿导航历史前进（撤销 back）
+func (w *Workspace) Forward() (common.Editor, error) {
+	editor, ok := w.navigate(&w.forwardStack, &w.backStack)
+	if !ok {
+		return nil, errors.New("没有可前进的文件")
+	}
+	return editor, nil
+}
+
+// navigate 从 from 栈中取出最近一个仍打开的文件设为活动文件，当前活动文件压入 to 栈
+func (w *Workspace) navigate(from, to *[]string) (common.Editor, bool) {
+	for len(*from) > 0 {
+		path := (*from)[len(*from)-1]
+		*from = (*from)[:len(*from)-1]
+		editor, ok := w.OpenEditors[path]
+		if !ok {
+			continue
+		}
+		if w.activeEditor != nil {
+			*to = append(*to, w.activeEditor.GetFilePath())
+		}
+		w.activate(editor, false)
+		return editor, true
+	}
+	return nil, false
+}
+
+// ------------------------------
+// 最近打开的文件（跨会话保存）
+// ------------------------------
+
+// SetRecentFile 设置最近打开文件列表的保存位置及最多记录的数量
+func (w *Workspace) SetRecentFile(path string, max int) {
+	w.recentPath = path
+	w.recentMax = max
+}
+
+// RecentFiles 最近打开的文件（最近的在前，路径相对工作区）
+func (w *Workspace) RecentFiles() []string {
+	if w.recentPath == "" {
+		return nil
+	}
+	data, err := os.ReadFile(w.recentPath)
+	if err != nil {
+		return nil
+	}
+	var files []string
+	for _, line := range strings.Split(string(data), "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			files = append(files, line)
+		}
+	}
+	return files
+}
+
+// touchRecent 将文件记为最近打开
+func (w *Workspace) touchRecent(path string) {
+	if w.recentPath == "" {
+		return
+	}
+	entry := w.toPortablePath(path)
+	files := append([]string{entry}, removePath(w.RecentFiles(), entry)...)
+	if w.recentMax > 0 && len(files) > w.recentMax {
+		files = files[:w.recentMax]
+	}
+	if err := os.MkdirAll(filepath.Dir(w.recentPath), 0755); err != nil {
+		return
+	}
+	// 原子写入，避免多个实例同时更新或中途退出时留下截断的列表
+	if err := writeFileAtomic(w.recentPath, []byte(strings.Join(files, "\n")+"\n")); err != nil {
+		fmt.Printf("警告：更新最近文件列表失败: %v\n", err)
+	}
+}
+
+// OpenRecent 打开最近文件列表中的第 n 个（从 1 开始）
+func (w *Workspace) OpenRecent(n int, editorFactory func(path string, w common.WorkSpaceApi) (common.Editor, error)) (common.Editor, error) {
+	files := w.RecentFiles()
+	if n < 1 || n > len(files) {
+		return nil, errors.New("最近文件编号超出范围")
+	}
+	return w.openPath(w.fromPortablePath(files[n-1]), editorFactory)
+}
@@ -0,0 +1,22 @@
+//go:build !windows
+
+package workspace
+
+import (
+	"errors"
+	"os"
+	"syscall"
+)
+
+// preserveOwner 将临时文件的属主设置为原文件的属主
+// 非 root 用户无权修改为他人属主时忽略该错误，仍保留权限位
+func preserveOwner(path string, info os.FileInfo) error {
+	st, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return nil
+	}
+	if err := os.Lchown(path, int(st.Uid), int(st.Gid)); err != nil && !errors.Is(err, os.ErrPermission) {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,10 @@
+//go:build windows
+
+package workspace
+
+import "os"
+
+// preserveOwner Windows 下文件属主由 ACL 管理，不做处理
+func preserveOwner(path string, info os.FileInfo) error {
+	return nil
+}
@@ -0,0 +1,63 @@
+//go:build !windows
+
+package workspace
+
+import (
+	"errors"
+	"os"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// processAlive 判断本机上的进程是否仍在运行（发送 0 号信号探测）
+func processAlive(pid int) bool {
+	if pid <= 0 {
+		return false
+	}
+	err := syscall.Kill(pid, 0)
+	return err == nil || errors.Is(err, syscall.EPERM)
+}
+
+// processStartTime 系统记录的进程启动时间（Linux 读取 /proc；其他系统无法获取时返回 false）
+func processStartTime(pid int) (time.Time, bool) {
+	data, err := os.ReadFile("/proc/" + strconv.Itoa(pid) + "/stat")
+	if err != nil {
+		return time.Time{}, false
+	}
+	// 第 2 个字段（进程名）可能含空格，从最后一个 ')' 之后开始按空白拆分；starttime 为第 22 个字段
+	stat := string(data)
+	fields := strings.Fields(stat[strings.LastIndexByte(stat, ')')+1:])
+	if len(fields) < 20 {
+		return time.Time{}, false
+	}
+	ticks, err := strconv.ParseInt(fields[19], 10, 64)
+	if err != nil {
+		return time.Time{}, false
+	}
+	boot, ok := bootTime()
+	if !ok {
+		return time.Time{}, false
+	}
+	// 内核按 USER_HZ（Linux 上固定为 100）计数
+	return boot.Add(time.Duration(ticks) * time.Second / 100), true
+}
+
+// bootTime 系统启动时间（/proc/stat 中的 btime）
+func bootTime() (time.Time, bool) {
+	data, err := os.ReadFile("/proc/stat")
+	if err != nil {
+		return time.Time{}, false
+	}
+	for _, line := range strings.Split(string(data), "\n") {
+		if fields := strings.Fields(line); len(fields) == 2 && fields[0] == "btime" {
+			sec, err := strconv.ParseInt(fields[1], 10, 64)
+			if err != nil {
+				return time.Time{}, false
+			}
+			return time.Unix(sec, 0), true
+		}
+	}
+	return time.Time{}, false
+}
@@ -0,0 +1,37 @@
+//go:build windows
+
+package workspace
+
+import (
+	"os"
+	"syscall"
+	"time"
+)
+
+// processAlive 判断本机上的进程是否仍在运行（Windows 下进程不存在时 FindProcess 返回错误）
+func processAlive(pid int) bool {
+	if pid <= 0 {
+		return false
+	}
+	p, err := os.FindProcess(pid)
+	if err != nil {
+		return false
+	}
+	p.Release()
+	return true
+}
+
+// processStartTime 系统记录的进程创建时间
+func processStartTime(pid int) (time.Time, bool) {
+	const processQueryLimitedInformation = 0x1000
+	h, err := syscall.OpenProcess(processQueryLimitedInformation, false, uint32(pid))
+	if err != nil {
+		return time.Time{}, false
+	}
+	defer syscall.CloseHandle(h)
+	var creation, exit, kernel, user syscall.Filetime
+	if err := syscall.GetProcessTimes(h, &creation, &exit, &kernel, &user); err != nil {
+		return time.Time{}, false
+	}
+	return time.Unix(0, creation.Nanoseconds()), true
+}
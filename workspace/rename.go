@@ -0,0 +1,187 @@
+package workspace
+
+import (
+	"errors"
+	"fmt"
+	"lab1/common"
+	"lab1/prompt"
+	"os"
+	"path/filepath"
+)
+
+// ------------------------------
+// 另存为与重命名（编辑器改为指向新路径，撤销历史与日志开关保持不变）
+// ------------------------------
+
+// replacePath 将路径列表中的旧路径替换为新路径
+func replacePath(list []string, oldPath, newPath string) {
+	for i, p := range list {
+		if p == oldPath {
+			list[i] = newPath
+		}
+	}
+}
+
+// rekeyEditor 将编辑器从旧路径移到新路径：OpenEditors、打开顺序、导航历史，并释放旧路径的交换文件和锁
+func (w *Workspace) rekeyEditor(editor common.Editor, oldPath, newPath string) {
+	delete(w.OpenEditors, oldPath)
+	w.OpenEditors[newPath] = editor
+	w.removeSwapFile(oldPath)
+	w.unlockEditor(oldPath)
+	delete(w.renamedTo, oldPath)
+
+	replacePath(w.openOrder, oldPath, newPath)
+	replacePath(w.mru, oldPath, newPath)
+	replacePath(w.backStack, oldPath, newPath)
+	replacePath(w.forwardStack, oldPath, newPath)
+	editor.SetFilePath(newPath)
+}
+
+// notifyRenamed 开启日志时通知观察者文件路径已变化，便于日志随文件迁移
+func (w *Workspace) notifyRenamed(editor common.Editor, eventType, oldPath, newPath string) {
+	w.notifyEditor(editor, common.EventRenamed, eventType, eventType+" "+oldPath+" -> "+newPath,
+		common.RenamePayload{From: oldPath, To: newPath, SaveAs: eventType == "SaveAs"})
+}
+
+// targetPath 解析另存为、重命名的目标路径，目标文件已在工作区中打开时返回错误
+func (w *Workspace) targetPath(input string) (string, error) {
+	newPath, err := w.ResolvePath(input)
+	if err != nil {
+		return "", err
+	}
+	if _, ok := w.OpenEditors[newPath]; ok {
+		return "", errors.New("目标文件已在工作区中打开: " + w.DisplayName(newPath))
+	}
+	return newPath, nil
+}
+
+// lockTarget 获取另存为目标文件的锁（改名后由编辑器继续持有），目标正被另一个存活的实例编辑时返回错误
+func (w *Workspace) lockTarget(path string) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return errors.New("创建目录失败: " + err.Error())
+	}
+	holder, err := acquireLock(path)
+	if err != nil {
+		return fmt.Errorf("无法为 %s 加锁: %w", w.DisplayName(path), err)
+	}
+	if holder != nil {
+		return fmt.Errorf("目标文件 %s 正被另一个实例编辑（%s）", w.DisplayName(path), holder)
+	}
+	w.fileLocks[path] = true
+	return nil
+}
+
+// SaveAs 将编辑器内容写入新路径，编辑器改为指向新文件（原文件保持不变），日志随编辑器迁移到新路径
+// 先获取目标文件的锁，目标正被另一个实例编辑时拒绝；目标文件已存在时询问是否覆盖；写入失败时编辑器和日志恢复为原路径
+func (w *Workspace) SaveAs(editor common.Editor, input string) error {
+	if editor == nil {
+		return errors.New("editor is nil: 编辑器实例为空")
+	}
+	oldPath := editor.GetFilePath()
+	if newPath, err := w.ResolvePath(input); err == nil && newPath == oldPath {
+		return w.SaveFile(editor)
+	}
+	newPath, err := w.targetPath(input)
+	if err != nil {
+		return err
+	}
+
+	if err := w.lockTarget(newPath); err != nil {
+		return err
+	}
+
+	// 目标文件已存在：确认覆盖后以其当前内容为基准，保存时直接覆盖而不做合并
+	newBase := ""
+	if data, err := os.ReadFile(newPath); err == nil {
+		answer, err := w.overwrite.Ask(fmt.Sprintf("文件 %s 已存在，是否覆盖?", w.DisplayName(newPath)))
+		if err != nil {
+			w.unlockEditor(newPath)
+			return err
+		}
+		if answer != prompt.Yes {
+			w.unlockEditor(newPath)
+			return ErrCancelled
+		}
+		newBase = string(data)
+	}
+
+	wasNew, readOnly := editor.IsNew(), editor.IsReadOnly()
+	base, stamp, state := editor.GetBaseContent(), editor.GetDiskStamp(), editor.GetDiskState()
+
+	w.rekeyEditor(editor, oldPath, newPath)
+	// 新位置视为尚未写入的文件：首次写入后由 SaveFile 加锁并记录快照
+	editor.SetNew(true)
+	editor.SetReadOnly(false)
+	editor.SetBaseContent(newBase)
+	editor.SetDiskStamp(common.FileStamp{})
+	editor.SetDiskState(common.DiskInSync)
+	// 保存事件写入新路径的日志之前迁移日志
+	w.migrateLog(editor, "SaveAs", oldPath, newPath)
+
+	if err := w.SaveFile(editor); err != nil {
+		w.rekeyEditor(editor, newPath, oldPath)
+		editor.SetNew(wasNew)
+		editor.SetReadOnly(readOnly)
+		editor.SetBaseContent(base)
+		editor.SetDiskStamp(stamp)
+		editor.SetDiskState(state)
+		w.lockEditor(editor)
+		w.migrateLog(editor, "SaveAs", newPath, oldPath)
+		return err
+	}
+	return nil
+}
+
+// migrateLog 等日志模块写完已发出的事件后将日志迁移到新路径，再通知观察者路径已变化，此后的日志写入新路径
+func (w *Workspace) migrateLog(editor common.Editor, eventType, oldPath, newPath string) {
+	w.FlushEvents()
+	if err := w.LogResolver().Migrate(oldPath, newPath); err != nil {
+		fmt.Printf("警告：迁移日志失败: %v\n", err)
+	}
+	w.notifyRenamed(editor, eventType, oldPath, newPath)
+}
+
+// Rename 将文件在磁盘上移动到新路径并更新编辑器；尚未写入磁盘的新缓冲区只修改路径
+// 目标文件已存在时不覆盖；文件的修订历史和日志随之迁移
+func (w *Workspace) Rename(editor common.Editor, input string) error {
+	if editor == nil {
+		return errors.New("editor is nil: 编辑器实例为空")
+	}
+	if editor.IsReadOnly() {
+		return errors.New("文件正被另一个实例编辑，当前以只读方式打开，无法重命名")
+	}
+	oldPath := editor.GetFilePath()
+	if newPath, err := w.ResolvePath(input); err == nil && newPath == oldPath {
+		return errors.New("新路径与原路径相同")
+	}
+	newPath, err := w.targetPath(input)
+	if err != nil {
+		return err
+	}
+	if _, err := os.Lstat(newPath); err == nil {
+		return errors.New("目标文件已存在: " + w.DisplayName(newPath))
+	}
+
+	if !editor.IsNew() {
+		if err := os.MkdirAll(filepath.Dir(newPath), 0755); err != nil {
+			return errors.New("创建目录失败: " + err.Error())
+		}
+		if err := os.Rename(oldPath, newPath); err != nil {
+			return errors.New("重命名失败: " + err.Error())
+		}
+	}
+
+	w.rekeyEditor(editor, oldPath, newPath)
+	if !editor.IsNew() {
+		w.refreshDiskStamp(editor)
+		w.lockEditor(editor)
+		w.touchRecent(newPath)
+		if w.revisions != nil {
+			if err := w.revisions.Rename(w.DisplayName(oldPath), w.DisplayName(newPath)); err != nil {
+				fmt.Printf("警告：迁移修订历史失败: %v\n", err)
+			}
+		}
+	}
+	w.migrateLog(editor, "Rename", oldPath, newPath)
+	return nil
+}
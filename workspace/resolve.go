@@ -0,0 +1,107 @@
+package workspace
+
+import (
+	"errors"
+	"lab1/common"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// ------------------------------
+// 文件标识：用户输入 -> 规范路径
+// ------------------------------
+//
+// 工作区内所有以路径为键的数据（OpenEditors、锁、交换文件、事件等）都使用规范路径：
+// 绝对路径、已清理、已解析符号链接。用户输入的相对路径相对于 root（默认 ./files）解析，
+// 显示给用户时使用相对工作区根目录的写法（如 files/a.txt）。
+
+// SetRoot 设置用户输入中相对路径的解析目录
+func (w *Workspace) SetRoot(root string) {
+	w.root = root
+}
+
+// Root 用户输入中相对路径的解析目录
+func (w *Workspace) Root() string {
+	return w.root
+}
+
+// canonicalPath 转换为绝对、已清理并解析符号链接的路径
+// 文件尚不存在时解析其最近一级已存在的上级目录，再拼接剩余部分
+func canonicalPath(path string) (string, error) {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return "", err
+	}
+	var rest []string
+	dir := abs
+	for {
+		if resolved, err := filepath.EvalSymlinks(dir); err == nil {
+			return filepath.Join(append([]string{resolved}, rest...)...), nil
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return abs, nil
+		}
+		rest = append([]string{filepath.Base(dir)}, rest...)
+		dir = parent
+	}
+}
+
+// ResolvePath 将用户输入的文件名转换为规范路径
+// 相对路径优先相对于 root 解析；若该位置既未打开也不存在，而相对于工作区根目录的同名文件存在或已打开（如输入 files/a.txt），则使用后者
+func (w *Workspace) ResolvePath(input string) (string, error) {
+	if strings.TrimSpace(input) == "" {
+		return "", errors.New("file path is empty: 文件路径不能为空")
+	}
+	if filepath.IsAbs(input) {
+		return canonicalPath(input)
+	}
+
+	primary, err := canonicalPath(filepath.Join(w.root, input))
+	if err != nil {
+		return "", err
+	}
+	if w.known(primary) {
+		return primary, nil
+	}
+	if alt, err := canonicalPath(filepath.Join(w.baseDir, input)); err == nil && w.known(alt) {
+		return alt, nil
+	}
+	return primary, nil
+}
+
+// known 文件已在工作区中打开或在磁盘上存在
+func (w *Workspace) known(path string) bool {
+	if _, ok := w.OpenEditors[path]; ok {
+		return true
+	}
+	_, err := os.Stat(path)
+	return err == nil
+}
+
+// FindEditor 按用户输入查找已打开的编辑器
+func (w *Workspace) FindEditor(input string) (common.Editor, bool) {
+	path, err := w.ResolvePath(input)
+	if err != nil {
+		return nil, false
+	}
+	editor, ok := w.OpenEditors[path]
+	return editor, ok
+}
+
+// DisplayName 规范路径的显示名：工作区内的文件显示为相对工作区根目录的路径，其余显示绝对路径
+func (w *Workspace) DisplayName(path string) string {
+	if path == "" || !filepath.IsAbs(path) {
+		return path
+	}
+	base, err := canonicalPath(w.baseDir)
+	if err != nil {
+		return path
+	}
+	rel, err := filepath.Rel(base, path)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return path
+	}
+	return rel
+}
@@ -0,0 +1,102 @@
+package workspace
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"lab1/common"
+	"strings"
+)
+
+// ------------------------------
+// 工作区恢复报告（逐个文件记录恢复结果）
+// ------------------------------
+
+// RestoreFailureKind 单个文件恢复失败的原因
+type RestoreFailureKind int
+
+const (
+	RestoreMissing     RestoreFailureKind = iota // 文件已不存在
+	RestoreUnsupported                           // 不支持的文件类型
+	RestorePermission                            // 无访问权限
+	RestoreOther                                 // 其他错误
+)
+
+// String 失败原因的描述
+func (k RestoreFailureKind) String() string {
+	switch k {
+	case RestoreMissing:
+		return "缺失"
+	case RestoreUnsupported:
+		return "类型不支持"
+	case RestorePermission:
+		return "无权限"
+	}
+	return "其他错误"
+}
+
+// RestoreFailure 单个文件的恢复失败记录
+type RestoreFailure struct {
+	Path string
+	Kind RestoreFailureKind
+	Err  error
+}
+
+// RestoreReport 工作区恢复结果
+type RestoreReport struct {
+	Total          int              // 备忘录中记录的文件数
+	Restored       []string         // 成功恢复的文件
+	Failures       []RestoreFailure // 恢复失败的文件
+	ActiveFallback string           // 原活动文件未能恢复时改用的活动文件（为空表示未发生回退）
+
+	display func(path string) string // 摘要中路径的显示方式
+}
+
+// classifyRestoreError 根据错误判断失败原因
+func classifyRestoreError(err error) RestoreFailureKind {
+	switch {
+	case errors.Is(err, fs.ErrNotExist):
+		return RestoreMissing
+	case errors.Is(err, common.ErrUnsupportedFileType):
+		return RestoreUnsupported
+	case errors.Is(err, fs.ErrPermission):
+		return RestorePermission
+	}
+	return RestoreOther
+}
+
+// addFailure 记录一个文件的恢复失败
+func (r *RestoreReport) addFailure(path string, err error) {
+	r.Failures = append(r.Failures, RestoreFailure{Path: path, Kind: classifyRestoreError(err), Err: err})
+}
+
+// displayName 路径的显示名
+func (r *RestoreReport) displayName(path string) string {
+	if r.display == nil {
+		return path
+	}
+	return r.display(path)
+}
+
+// Summary 恢复结果摘要，如“已恢复 4/5 个文件，1 个缺失: files/a.txt”
+func (r *RestoreReport) Summary() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "已恢复 %d/%d 个文件", len(r.Restored), r.Total)
+
+	// 按失败原因分组输出
+	for _, kind := range []RestoreFailureKind{RestoreMissing, RestoreUnsupported, RestorePermission, RestoreOther} {
+		var paths []string
+		for _, f := range r.Failures {
+			if f.Kind == kind {
+				paths = append(paths, r.displayName(f.Path))
+			}
+		}
+		if len(paths) > 0 {
+			fmt.Fprintf(&b, "，%d 个%s: %s", len(paths), kind, strings.Join(paths, ", "))
+		}
+	}
+	if r.ActiveFallback != "" {
+		fmt.Fprintf(&b, "；原活动文件未能恢复，已切换到 %s", r.displayName(r.ActiveFallback))
+	}
+	return b.String()
+}
@@ -0,0 +1,193 @@
+package workspace
+
+import (
+	"errors"
+	"fmt"
+	"lab1/logpath"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// ------------------------------
+// 原子、持久化的文件保存与备份
+// ------------------------------
+
+// BackupMode 保存前对旧文件的备份方式
+type BackupMode int
+
+const (
+	BackupNone        BackupMode = iota // 不备份
+	BackupSimple                        // 单个备份 file~
+	BackupTimestamped                   // 带时间戳的备份 file.20060102-150405~
+)
+
+// SaveOptions 保存选项
+type SaveOptions struct {
+	Backup     BackupMode
+	BackupKeep int // 时间戳备份的保留数量（<=0 表示不清理）
+}
+
+// ParseBackupMode 解析命令行中的备份方式：none / simple / timestamped
+func ParseBackupMode(s string) (BackupMode, error) {
+	switch s {
+	case "", "none":
+		return BackupNone, nil
+	case "simple":
+		return BackupSimple, nil
+	case "timestamped":
+		return BackupTimestamped, nil
+	}
+	return BackupNone, errors.New("未知的备份方式: " + s + "（可选 none/simple/timestamped）")
+}
+
+// SetSaveOptions 设置保存选项
+func (w *Workspace) SetSaveOptions(opts SaveOptions) {
+	w.saveOptions = opts
+}
+
+// writeFile 按保存选项备份旧文件后，原子地写入新内容
+func (w *Workspace) writeFile(path string, data []byte) error {
+	// 符号链接：写入链接指向的真实文件，保留链接本身
+	if target, err := filepath.EvalSymlinks(path); err == nil {
+		path = target
+	}
+	if err := w.backupFile(path); err != nil {
+		return fmt.Errorf("备份旧文件失败: %w", err)
+	}
+	return writeFileAtomic(path, data)
+}
+
+// writeFileAtomic 先写同目录下的临时文件并 fsync，再保留原权限和属主，最后原子地重命名到目标路径
+// 写入中途崩溃时原文件保持完整
+func writeFileAtomic(path string, data []byte) (err error) {
+	dir := filepath.Dir(path)
+	info, statErr := os.Stat(path)
+
+	tmp, err := os.CreateTemp(dir, "."+filepath.Base(path)+".tmp-*")
+	if err != nil {
+		return err
+	}
+	tmpPath := tmp.Name()
+	defer func() {
+		if err != nil {
+			tmp.Close()
+			os.Remove(tmpPath)
+		}
+	}()
+
+	if _, err = tmp.Write(data); err != nil {
+		return err
+	}
+	if err = tmp.Sync(); err != nil {
+		return err
+	}
+	if err = tmp.Close(); err != nil {
+		return err
+	}
+
+	// 保留原文件的权限和属主；新文件使用 0644
+	mode := os.FileMode(0644)
+	if statErr == nil {
+		mode = info.Mode().Perm()
+		if err = preserveOwner(tmpPath, info); err != nil {
+			return err
+		}
+	}
+	if err = os.Chmod(tmpPath, mode); err != nil {
+		return err
+	}
+
+	if err = os.Rename(tmpPath, path); err != nil {
+		return err
+	}
+	syncDir(dir)
+	return nil
+}
+
+// syncDir 对目录执行 fsync，使重命名操作落盘（部分平台不支持，忽略错误）
+func syncDir(dir string) {
+	d, err := os.Open(dir)
+	if err != nil {
+		return
+	}
+	d.Sync()
+	d.Close()
+}
+
+// backupFile 保存前备份磁盘上的旧文件
+func (w *Workspace) backupFile(path string) error {
+	if w.saveOptions.Backup == BackupNone {
+		return nil
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil // 首次保存，没有可备份的旧文件
+		}
+		return err
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	backupPath := path + "~"
+	if w.saveOptions.Backup == BackupTimestamped {
+		backupPath = timestampedBackupPath(path, time.Now())
+	}
+	if err := writeFileAtomic(backupPath, data); err != nil {
+		return err
+	}
+	if err := os.Chmod(backupPath, info.Mode().Perm()); err != nil {
+		return err
+	}
+
+	if w.saveOptions.Backup == BackupTimestamped {
+		pruneBackups(path, w.saveOptions.BackupKeep)
+	}
+	return nil
+}
+
+// 时间戳备份的时间格式（纳秒精度，同一秒内多次保存不会互相覆盖）
+const backupStampLayout = "20060102-150405.000000000"
+
+// timestampedBackupPath 返回 file.20060102-150405.000000000~ 形式的备份路径，已存在时递增时间直到不冲突
+func timestampedBackupPath(path string, now time.Time) string {
+	for {
+		backupPath := path + "." + now.Format(backupStampLayout) + "~"
+		if _, err := os.Lstat(backupPath); os.IsNotExist(err) {
+			return backupPath
+		}
+		now = now.Add(time.Nanosecond)
+	}
+}
+
+// pruneBackups 按时间戳从旧到新删除多余的备份，只保留最新的 keep 个
+func pruneBackups(path string, keep int) {
+	if keep <= 0 {
+		return
+	}
+	// 文件名中的 [ * ? 需转义，否则匹配不到自己的备份
+	matches, err := filepath.Glob(logpath.GlobEscape(path) + ".*~")
+	if err != nil {
+		return
+	}
+	backups := make([]string, 0, len(matches))
+	prefix := path + "."
+	for _, m := range matches {
+		// 只处理 file.<时间戳>~ 形式的备份
+		stamp := strings.TrimSuffix(strings.TrimPrefix(m, prefix), "~")
+		if _, err := time.Parse(backupStampLayout, stamp); err == nil {
+			backups = append(backups, m)
+		}
+	}
+	// 时间戳格式按字典序即按时间排序
+	sort.Strings(backups)
+	for len(backups) > keep {
+		os.Remove(backups[0])
+		backups = backups[1:]
+	}
+}
@@ -0,0 +1,202 @@
+package workspace
+
+import (
+	"errors"
+	"fmt"
+	"lab1/common"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// ------------------------------
+// 命名会话（每个会话保存一份独立的工作区备忘录）
+// ------------------------------
+//
+// 目录结构：
+//   .fdu/sessions/<会话名>.json   会话的备忘录
+//   .fdu/sessions/.last           上次使用的会话名（启动时优先恢复）
+
+// SessionInfo 会话列表中的一项
+type SessionInfo struct {
+	Name    string
+	Files   int       // 会话中打开的文件数
+	ModTime time.Time // 最后保存时间
+	Current bool      // 是否为当前会话
+}
+
+// SetSessionDir 设置会话备忘录的存放目录
+func (w *Workspace) SetSessionDir(dir string) {
+	w.sessionDir = dir
+}
+
+// CurrentSession 当前会话名（为空表示使用默认的工作区状态文件）
+func (w *Workspace) CurrentSession() string {
+	return w.session
+}
+
+// MementoPath 当前使用的备忘录路径
+func (w *Workspace) MementoPath() string {
+	return w.mementoPath
+}
+
+// validateSessionName 会话名只能是普通文件名
+func validateSessionName(name string) error {
+	if name == "" {
+		return errors.New("会话名不能为空")
+	}
+	if strings.ContainsAny(name, `/\`) || strings.HasPrefix(name, ".") {
+		return fmt.Errorf("无效的会话名: %s（不能包含路径分隔符或以 . 开头）", name)
+	}
+	return nil
+}
+
+// sessionPath 返回会话备忘录的路径
+func (w *Workspace) sessionPath(name string) string {
+	return filepath.Join(w.sessionDir, name+".json")
+}
+
+// lastSessionPath 记录上次使用的会话名的文件
+func (w *Workspace) lastSessionPath() string {
+	return filepath.Join(w.sessionDir, ".last")
+}
+
+// UseLastSession 启动时切换到上次使用的会话（会话已不存在时使用默认状态文件），返回会话名
+// 需在 AcquireStateLock、RestoreState 之前调用
+func (w *Workspace) UseLastSession() string {
+	data, err := os.ReadFile(w.lastSessionPath())
+	if err != nil {
+		return ""
+	}
+	name := strings.TrimSpace(string(data))
+	if validateSessionName(name) != nil {
+		return ""
+	}
+	if _, err := os.Stat(w.sessionPath(name)); err != nil {
+		return ""
+	}
+	w.session = name
+	w.mementoPath = w.sessionPath(name)
+	return name
+}
+
+// switchSession 切换备忘录路径及其状态锁，并记录为上次使用的会话
+func (w *Workspace) switchSession(name string) error {
+	if err := os.MkdirAll(w.sessionDir, 0755); err != nil {
+		return err
+	}
+	if w.stateLockHolder == nil {
+		releaseLock(w.mementoPath)
+	}
+	w.session = name
+	w.mementoPath = w.sessionPath(name)
+	w.AcquireStateLock()
+	return os.WriteFile(w.lastSessionPath(), []byte(name+"\n"), 0644)
+}
+
+// SaveSession 将当前打开的文件集合保存为命名会话，并切换到该会话
+func (w *Workspace) SaveSession(name string) error {
+	if err := validateSessionName(name); err != nil {
+		return err
+	}
+	if name != w.session {
+		if err := w.switchSession(name); err != nil {
+			return err
+		}
+	}
+	return w.SaveState()
+}
+
+// OpenSession 保存并关闭当前文件集合，再恢复指定会话（已修改的缓冲区需由调用方事先处理）
+func (w *Workspace) OpenSession(name string, editorFactory func(path string, ws common.WorkSpaceApi) (common.Editor, error),
+	bufferFactory func(path, content string, ws common.WorkSpaceApi) (common.Editor, error)) (*RestoreReport, error) {
+	if err := validateSessionName(name); err != nil {
+		return nil, err
+	}
+	if name == w.session {
+		return nil, fmt.Errorf("已在会话 %s 中", name)
+	}
+	if _, err := os.Stat(w.sessionPath(name)); err != nil {
+		return nil, fmt.Errorf("会话不存在: %s", name)
+	}
+
+	// 当前文件集合保存到原来的会话（或默认状态文件）；保存失败时不切换，已打开的编辑器保持不变
+	if err := w.SaveState(); err != nil {
+		return nil, fmt.Errorf("保存当前工作区状态失败，未切换会话: %w", err)
+	}
+	w.closeAllEditors()
+
+	if err := w.switchSession(name); err != nil {
+		return nil, err
+	}
+	return w.RestoreState(editorFactory, bufferFactory)
+}
+
+// closeAllEditors 关闭所有已打开的编辑器（不保存内容）
+func (w *Workspace) closeAllEditors() {
+	for path, editor := range w.OpenEditors {
+		w.notifyEditor(editor, common.EventFileClosed, "Close", "Close "+path,
+			common.FilePayload{Version: editor.Version(), New: editor.IsNew()})
+		delete(w.OpenEditors, path)
+		w.removeSwapFile(path)
+		w.unlockEditor(path)
+	}
+	w.activeEditor = nil
+	w.renamedTo = make(map[string]string)
+	w.openOrder, w.mru, w.backStack, w.forwardStack = nil, nil, nil, nil
+}
+
+// ListSessions 列出所有会话（按名称排序）
+func (w *Workspace) ListSessions() ([]SessionInfo, error) {
+	files, err := filepath.Glob(filepath.Join(w.sessionDir, "*.json"))
+	if err != nil {
+		return nil, err
+	}
+	sessions := make([]SessionInfo, 0, len(files))
+	for _, file := range files {
+		name := strings.TrimSuffix(filepath.Base(file), ".json")
+		if validateSessionName(name) != nil {
+			continue
+		}
+		info := SessionInfo{Name: name, Current: name == w.session}
+		if stat, err := os.Stat(file); err == nil {
+			info.ModTime = stat.ModTime()
+		}
+		if data, err := os.ReadFile(file); err == nil {
+			if memento, err := decodeMemento(data); err == nil {
+				info.Files = len(memento.OpenedFilePaths)
+			}
+		}
+		sessions = append(sessions, info)
+	}
+	sort.Slice(sessions, func(i, j int) bool { return sessions[i].Name < sessions[j].Name })
+	return sessions, nil
+}
+
+// DeleteSession 删除会话的备忘录及其旁路文件（不能删除当前会话或其他实例正在使用的会话）
+func (w *Workspace) DeleteSession(name string) error {
+	if err := validateSessionName(name); err != nil {
+		return err
+	}
+	if name == w.session {
+		return fmt.Errorf("不能删除当前会话 %s，请先切换到其他会话", name)
+	}
+	path := w.sessionPath(name)
+	if holder, err := readLock(path); err == nil && !holder.isOurs() && holder.alive() {
+		return fmt.Errorf("会话 %s 正被另一个实例使用（%s）", name, holder)
+	}
+	if err := os.Remove(path); err != nil {
+		if os.IsNotExist(err) {
+			return fmt.Errorf("会话不存在: %s", name)
+		}
+		return err
+	}
+	os.Remove(lockPath(path))
+	if w.bufferDir != "" {
+		os.RemoveAll(filepath.Join(w.bufferDir, url.PathEscape(filepath.Base(path))))
+	}
+	return nil
+}
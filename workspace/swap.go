@@ -0,0 +1,278 @@
+package workspace
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"lab1/common"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// ------------------------------
+// 自动保存与崩溃恢复（交换文件 .file.txt.swp）
+// ------------------------------
+
+// SwapOptions 自动保存选项
+type SwapOptions struct {
+	Interval   time.Duration // 定时写交换文件的间隔（<=0 表示不启用定时器）
+	EveryEdits int           // 累计编辑 N 次后写交换文件（<=0 表示不启用）
+}
+
+// SwapFile 交换文件内容：缓冲区全文及编辑器元数据
+type SwapFile struct {
+	FilePath    string
+	Content     string
+	BaseContent string // 加载时的磁盘内容，恢复后仍可与磁盘做三方合并
+	LogEnabled  bool
+	PID         int
+	Host        string    // 写入交换文件的实例所在主机（旧版本的交换文件为空）
+	StartTime   time.Time // 写入交换文件的实例的启动时间（识别被复用的 PID）
+	SavedAt     time.Time
+}
+
+// ownedByLiveInstance 交换文件由本机上另一个仍在运行的实例写入：其缓冲区仍在编辑中，不能恢复或丢弃
+// 其他主机上的实例无法探测，按遗留文件处理
+func (s *SwapFile) ownedByLiveInstance() bool {
+	self := currentLockInfo()
+	if s.PID <= 0 || s.PID == self.PID {
+		return false
+	}
+	if s.Host != "" && s.Host != self.Host {
+		return false
+	}
+	return LockInfo{PID: s.PID, Host: self.Host, StartTime: s.StartTime}.alive()
+}
+
+// swapPath 返回文件对应的交换文件路径：同目录下的 .文件名.swp
+func swapPath(path string) string {
+	return filepath.Join(filepath.Dir(path), "."+filepath.Base(path)+".swp")
+}
+
+// SetSwapOptions 设置自动保存选项
+func (w *Workspace) SetSwapOptions(opts SwapOptions) {
+	w.swapOptions = opts
+}
+
+// StartAutosave 启动定时自动保存
+func (w *Workspace) StartAutosave() {
+	if w.stopAutosave != nil || w.swapOptions.Interval <= 0 {
+		return
+	}
+	w.stopAutosave = make(chan struct{})
+	go func(stop chan struct{}) {
+		ticker := time.NewTicker(w.swapOptions.Interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				w.Lock()
+				w.writeSwapFiles(1)
+				w.Unlock()
+			case <-stop:
+				return
+			}
+		}
+	}(w.stopAutosave)
+}
+
+// StopAutosave 停止定时自动保存
+func (w *Workspace) StopAutosave() {
+	if w.stopAutosave != nil {
+		close(w.stopAutosave)
+		w.stopAutosave = nil
+	}
+}
+
+// AutosaveAfterEdits 每条指令执行后调用：编辑次数达到阈值的缓冲区写入交换文件
+// 调用方需持有工作区锁
+func (w *Workspace) AutosaveAfterEdits() {
+	if w.swapOptions.EveryEdits > 0 {
+		w.writeSwapFiles(w.swapOptions.EveryEdits)
+	}
+}
+
+// writeSwapFiles 为距上次写入已编辑 minEdits 次以上的已修改缓冲区写交换文件，已保存的缓冲区删除交换文件
+func (w *Workspace) writeSwapFiles(minEdits int) {
+	for path, editor := range w.OpenEditors {
+		if !editor.IsModified() {
+			if _, ok := w.swappedEdits[path]; ok {
+				w.removeSwapFile(path)
+			}
+			continue
+		}
+		// 从未写过交换文件的编辑器从 0 开始计数
+		if editor.EditCount()-w.swappedEdits[path] < minEdits {
+			continue
+		}
+		if err := w.writeSwapFile(editor); err != nil {
+			fmt.Printf("警告：写入交换文件失败 %s: %v\n", swapPath(path), err)
+		}
+	}
+}
+
+// writeSwapFile 写入单个编辑器的交换文件
+func (w *Workspace) writeSwapFile(editor common.Editor) error {
+	path := editor.GetFilePath()
+	data, err := json.MarshalIndent(SwapFile{
+		FilePath:    path,
+		Content:     editor.GetContent(),
+		BaseContent: editor.GetBaseContent(),
+		LogEnabled:  editor.IsLogEnabled(),
+		PID:         os.Getpid(),
+		Host:        currentLockInfo().Host,
+		StartTime:   processStart,
+		SavedAt:     time.Now(),
+	}, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	if err := writeFileAtomic(swapPath(path), data); err != nil {
+		return err
+	}
+	w.swappedEdits[path] = editor.EditCount()
+	return nil
+}
+
+// removeSwapFile 删除文件的交换文件（保存、关闭、正常退出时调用）
+func (w *Workspace) removeSwapFile(path string) {
+	delete(w.swappedEdits, path)
+	if _, pending := w.pendingSwaps[path]; pending {
+		return // 上次遗留、尚未处理的交换文件保留，等待 recover/discard
+	}
+	if err := os.Remove(swapPath(path)); err != nil && !os.IsNotExist(err) {
+		fmt.Printf("警告：删除交换文件失败 %s: %v\n", swapPath(path), err)
+	}
+}
+
+// FlushSwapFiles 立即为所有已修改的缓冲区写交换文件，返回写入的数量（无法保存缓冲区内容就退出时调用）
+func (w *Workspace) FlushSwapFiles() int {
+	w.writeSwapFiles(0)
+	n := 0
+	for _, editor := range w.OpenEditors {
+		if editor.IsModified() {
+			n++
+		}
+	}
+	return n
+}
+
+// RemoveSwapFiles 删除本次会话写入的所有交换文件（正常退出时调用）
+func (w *Workspace) RemoveSwapFiles() {
+	for path := range w.swappedEdits {
+		w.removeSwapFile(path)
+	}
+}
+
+// detectSwapFiles 扫描给定目录中上次遗留的交换文件，记录为待处理（本机上仍在运行的实例正在使用的交换文件除外）
+func (w *Workspace) detectSwapFiles(dirs []string) {
+	seen := make(map[string]bool)
+	for _, dir := range dirs {
+		dir = filepath.Clean(dir)
+		if seen[dir] {
+			continue
+		}
+		seen[dir] = true
+
+		entries, err := os.ReadDir(dir)
+		if err != nil {
+			continue
+		}
+		for _, entry := range entries {
+			name := entry.Name()
+			if entry.IsDir() || !strings.HasPrefix(name, ".") || !strings.HasSuffix(name, ".swp") {
+				continue
+			}
+			data, err := os.ReadFile(filepath.Join(dir, name))
+			if err != nil {
+				continue
+			}
+			var swap SwapFile
+			if err := json.Unmarshal(data, &swap); err != nil {
+				fmt.Printf("警告：交换文件已损坏，已忽略: %s\n", filepath.Join(dir, name))
+				continue
+			}
+			if swap.ownedByLiveInstance() {
+				fmt.Printf("交换文件 %s 属于正在运行的实例（进程 %d），已跳过\n", filepath.Join(dir, name), swap.PID)
+				continue
+			}
+			// 以交换文件所在位置为准，避免文件被移动后路径不一致
+			swap.FilePath = filepath.Join(dir, strings.TrimSuffix(strings.TrimPrefix(name, "."), ".swp"))
+			if canonical, err := canonicalPath(swap.FilePath); err == nil {
+				swap.FilePath = canonical
+			}
+			w.pendingSwaps[swap.FilePath] = &swap
+		}
+	}
+}
+
+// PendingSwaps 返回上次遗留、尚未 recover/discard 的交换文件（按路径排序）
+func (w *Workspace) PendingSwaps() []*SwapFile {
+	swaps := make([]*SwapFile, 0, len(w.pendingSwaps))
+	for _, swap := range w.pendingSwaps {
+		swaps = append(swaps, swap)
+	}
+	sort.Slice(swaps, func(i, j int) bool { return swaps[i].FilePath < swaps[j].FilePath })
+	return swaps
+}
+
+// findPendingSwap 按用户输入查找待处理的交换文件（支持 root 目录下的文件名或相对工作区的路径）
+func (w *Workspace) findPendingSwap(name string) (string, *SwapFile, error) {
+	for _, path := range []string{filepath.Join(w.root, name), filepath.Join(w.baseDir, name), name} {
+		path, err := canonicalPath(path)
+		if err != nil {
+			continue
+		}
+		if swap, ok := w.pendingSwaps[path]; ok {
+			return path, swap, nil
+		}
+	}
+	return "", nil, errors.New("没有找到该文件的交换文件: " + name)
+}
+
+// RecoverSwap 用交换文件中的内容恢复缓冲区（文件未打开时先打开），恢复操作可撤销
+func (w *Workspace) RecoverSwap(name string, editorFactory func(path string, ws common.WorkSpaceApi) (common.Editor, error)) (common.Editor, error) {
+	path, swap, err := w.findPendingSwap(name)
+	if err != nil {
+		return nil, err
+	}
+
+	// 与 load 走同一条打开路径（加锁、FileLoaded 事件、最近文件列表）；已打开时只切换
+	editor, err := w.openPath(path, editorFactory)
+	if err != nil {
+		return nil, err
+	}
+
+	if swap.Content != editor.GetContent() {
+		if err := editor.SetContent(swap.Content); err != nil {
+			return nil, err
+		}
+	}
+	// 恢复的内容作为一次可撤销的编辑写入，撤销后回到磁盘内容即为未修改
+	editor.SetBaseContent(swap.BaseContent)
+	w.SetActiveEditor(editor)
+
+	// 交换文件交由自动保存接管，保存或正常退出后删除
+	delete(w.pendingSwaps, path)
+	w.swappedEdits[path] = -1
+	return editor, nil
+}
+
+// DiscardSwap 丢弃上次遗留的交换文件
+func (w *Workspace) DiscardSwap(name string) error {
+	path, _, err := w.findPendingSwap(name)
+	if err != nil {
+		return err
+	}
+	delete(w.pendingSwaps, path)
+	if err := os.Remove(swapPath(path)); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
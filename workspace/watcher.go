@@ -0,0 +1,189 @@
+package workspace
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"lab1/common"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// ------------------------------
+// 外部修改检测（轮询磁盘，不依赖 inotify）
+// ------------------------------
+
+// readStamp 读取文件内容并生成磁盘快照
+func readStamp(path string) (common.FileStamp, []byte, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return common.FileStamp{}, nil, err
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return common.FileStamp{}, nil, err
+	}
+	sum := sha256.Sum256(data)
+	return common.FileStamp{
+		ModTime: info.ModTime(),
+		Size:    info.Size(),
+		Hash:    hex.EncodeToString(sum[:]),
+	}, data, nil
+}
+
+// refreshDiskStamp 在加载、保存、重新加载后记录文件的最新快照
+func (w *Workspace) refreshDiskStamp(editor common.Editor) {
+	stamp, _, err := readStamp(editor.GetFilePath())
+	if err != nil {
+		// 文件尚未写入磁盘（例如 init 创建的缓冲区），保持空快照
+		editor.SetDiskStamp(common.FileStamp{})
+		return
+	}
+	editor.SetDiskStamp(stamp)
+	editor.SetDiskState(common.DiskInSync)
+	delete(w.renamedTo, editor.GetFilePath())
+}
+
+// StartWatcher 启动后台轮询，每隔 interval 检查一次已打开文件在磁盘上的变化
+func (w *Workspace) StartWatcher(interval time.Duration) {
+	if w.stopWatcher != nil {
+		return
+	}
+	w.stopWatcher = make(chan struct{})
+	go func(stop chan struct{}) {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				w.Lock()
+				w.CheckExternalChanges()
+				w.Unlock()
+			case <-stop:
+				return
+			}
+		}
+	}(w.stopWatcher)
+}
+
+// StopWatcher 停止后台轮询
+func (w *Workspace) StopWatcher() {
+	if w.stopWatcher != nil {
+		close(w.stopWatcher)
+		w.stopWatcher = nil
+	}
+}
+
+// CheckExternalChanges 检查所有已打开文件：未修改的缓冲区静默重新加载，已修改的标记为“磁盘已变更”
+// 调用方需持有工作区锁
+func (w *Workspace) CheckExternalChanges() {
+	for path, editor := range w.OpenEditors {
+		stamp := editor.GetDiskStamp()
+		if stamp.Hash == "" {
+			continue // 从未写入磁盘的缓冲区无需检测
+		}
+
+		info, err := os.Stat(path)
+		if err != nil {
+			if os.IsNotExist(err) && editor.GetDiskState() != common.DiskDeleted {
+				editor.SetDiskState(common.DiskDeleted)
+				if newPath := findRenamed(path, stamp, w.OpenEditors); newPath != "" {
+					w.renamedTo[path] = newPath
+				}
+			}
+			continue
+		}
+		if info.ModTime().Equal(stamp.ModTime) && info.Size() == stamp.Size && editor.GetDiskState() != common.DiskDeleted {
+			continue
+		}
+
+		newStamp, _, err := readStamp(path)
+		if err != nil {
+			continue
+		}
+		if newStamp.Hash == stamp.Hash {
+			// 仅修改时间变化（如 touch），内容未变
+			editor.SetDiskStamp(newStamp)
+			editor.SetDiskState(common.DiskInSync)
+			delete(w.renamedTo, path)
+			continue
+		}
+
+		if editor.IsModified() {
+			editor.SetDiskState(common.DiskChanged)
+			continue
+		}
+		if err := w.ReloadFile(editor, false); err != nil {
+			editor.SetDiskState(common.DiskChanged)
+		}
+	}
+}
+
+// findRenamed 在同目录下查找内容与快照一致、且未被打开的文件，作为重命名后的新路径
+func findRenamed(path string, stamp common.FileStamp, openEditors map[string]common.Editor) string {
+	dir := filepath.Dir(path)
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return ""
+	}
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+		candidate := filepath.Join(dir, entry.Name())
+		if _, open := openEditors[candidate]; open {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil || info.Size() != stamp.Size {
+			continue
+		}
+		if newStamp, _, err := readStamp(candidate); err == nil && newStamp.Hash == stamp.Hash {
+			return candidate
+		}
+	}
+	return ""
+}
+
+// DiskStatus 返回编辑器与磁盘同步状态的描述（供 editor-list 显示），一致时返回空串
+func (w *Workspace) DiskStatus(editor common.Editor) string {
+	switch editor.GetDiskState() {
+	case common.DiskChanged:
+		return "changed on disk"
+	case common.DiskDeleted:
+		if newPath, ok := w.renamedTo[editor.GetFilePath()]; ok {
+			return "renamed on disk to " + w.DisplayName(newPath)
+		}
+		return "deleted on disk"
+	}
+	return ""
+}
+
+// ReloadFile 从磁盘重新加载文件内容，作为一次可撤销的编辑写入缓冲区
+// 缓冲区有未保存的修改时，需 force 才会覆盖
+func (w *Workspace) ReloadFile(editor common.Editor, force bool) error {
+	if editor == nil {
+		return errors.New("editor is nil: 编辑器实例为空")
+	}
+	if editor.IsModified() && !force {
+		return errors.New("文件有未保存的修改，如需丢弃请使用 reload --force")
+	}
+
+	stamp, data, err := readStamp(editor.GetFilePath())
+	if err != nil {
+		return fmt.Errorf("读取磁盘内容失败: %w", err)
+	}
+
+	if content := string(data); content != editor.GetContent() {
+		editor.ReloadContent(content)
+	}
+	editor.SetBaseContent(string(data))
+	editor.MarkAsModified(false)
+	editor.SetMergeConflicts(false)
+	editor.SetDiskStamp(stamp)
+	editor.SetDiskState(common.DiskInSync)
+	delete(w.renamedTo, editor.GetFilePath())
+	return nil
+}
@@ -3,9 +3,18 @@ package workspace
 import (
 	"encoding/json"
 	"errors"
+	"fmt"
+	"io"
 	"lab1/common"
+	"lab1/eventbus"
+	"lab1/logpath"
+	"lab1/prompt"
+	"lab1/revision"
+	"lab1/textdiff"
 	"os"
 	"path/filepath"
+	"strings"
+	"sync"
 	"time"
 )
 
@@ -21,10 +30,13 @@ import (
 
 // WorkspaceMemento 工作区状态备忘录（用于持久化）
 type WorkspaceMemento struct {
-	OpenedFilePaths   []string // 已打开文件路径列表
+	Version           int      // 备忘录格式版本（见 CurrentMementoVersion）
+	OpenedFilePaths   []string // 已打开文件路径列表（相对工作区的正斜杠路径，下同）
 	ActiveFilePath    string   // 当前活动文件路径
 	ModifiedFilePaths []string // 已修改文件路径列表
 	FileStates        []FileState
+
+	sidecars []sidecarBuffer // sidecar 模式下待写入旁路文件的缓冲区内容（不序列化）
 }
 
 //这里的文件日志状态切片，是需要修改的，因为真实的各种状态会动态变化，这里要加一个方法供调用
@@ -32,6 +44,13 @@ type WorkspaceMemento struct {
 type FileState struct {
 	FilePath   string
 	LogEnabled bool // 该文件的日志开关状态
+
+	// 已修改或从未保存的缓冲区内容（按保存方式二选一），用于重启后原样恢复
+	BufferContent  *string `json:",omitempty"` // embed：缓冲区全文
+	BufferBase     *string `json:",omitempty"` // embed：缓冲区对应的磁盘基准内容（三方合并用）
+	BufferFile     string  `json:",omitempty"` // sidecar：保存缓冲区全文的旁路文件
+	NeverSaved     bool    `json:",omitempty"` // 缓冲区从未写入磁盘（如 init 创建）
+	MergeConflicts bool    `json:",omitempty"` // 缓冲区中有合并插入的冲突标记尚未解决
 }
 
 // ------------------------------
@@ -44,8 +63,45 @@ type Workspace struct {
 	//UnsavedEditors map[string]Editor
 	activeEditor common.Editor
 	//isLogEnabled bool
-	observers   []common.Observer
+	events      *eventbus.Bus // 事件总线：观察者异步接收工作区事件
+	inCommand   bool          // 正在执行用户指令（见 BeginCommand）
 	mementoPath string
+
+	mu          sync.Mutex        // 交互循环与后台轮询之间的互斥锁
+	stopWatcher chan struct{}     // 关闭后停止后台轮询
+	renamedTo   map[string]string // 磁盘上被重命名的文件：原路径 -> 新路径
+	saveOptions SaveOptions       // 保存时的备份选项
+
+	swapOptions  SwapOptions          // 自动保存选项
+	stopAutosave chan struct{}        // 关闭后停止定时自动保存
+	swappedEdits map[string]int       // 已写交换文件的编辑器：路径 -> 写入时的编辑次数
+	pendingSwaps map[string]*SwapFile // 上次遗留、等待 recover/discard 的交换文件
+
+	fileLocks       map[string]bool // 本实例持有锁的文件
+	logged          map[string]bool // 本会话已为其发出事件或已轮转日志的文件（见 rotateLogs）
+	stateLockHolder *LockInfo       // 工作区状态文件被其他实例锁定时的持有者
+
+	revisions *revision.Store   // 本地修订历史，为 nil 时不记录
+	logs      *logpath.Resolver // 日志路径策略，为 nil 时使用 logpath.Default()
+
+	bufferMode BufferMode // 备忘录中未保存缓冲区内容的保存方式
+	bufferDir  string     // sidecar 模式下旁路文件的存放目录
+
+	baseDir string // 工作区根目录，备忘录中的路径相对于此目录
+	root    string // 用户输入中相对路径的解析目录
+
+	session    string // 当前会话名，为空表示使用默认的工作区状态文件
+	sessionDir string // 命名会话备忘录的存放目录
+
+	prompter  prompt.Prompter // 已修改文件在关闭、退出时的确认方式
+	overwrite prompt.Prompter // 另存为覆盖已有文件时的确认方式（与 -on-dirty 策略无关）
+
+	openOrder    []string // 已打开文件的打开顺序（editor-list 按此顺序列出）
+	mru          []string // 最近使用顺序，最近的在前
+	backStack    []string // back 可回到的文件
+	forwardStack []string // forward 可回到的文件
+	recentPath   string   // 最近打开文件列表的保存位置
+	recentMax    int      // 最近打开文件最多记录的数量
 }
 
 // NewWorkspace 创建工作区实例
@@ -54,33 +110,121 @@ func NewWorkspace(mementoPath string) *Workspace {
 		OpenEditors: make(map[string]common.Editor),
 		//UnsavedEditors: make(map[string]Editor), // 初始化未保存缓冲区
 		mementoPath: mementoPath,
+		renamedTo:   make(map[string]string),
+
+		swappedEdits: make(map[string]int),
+		pendingSwaps: make(map[string]*SwapFile),
+		fileLocks:    make(map[string]bool),
+		logged:       make(map[string]bool),
+		baseDir:      ".",
+		root:         "./files",
+		prompter:     prompt.Fail(), // 未设置确认方式时拒绝关闭已修改的文件，不静默丢弃
+		overwrite:    prompt.Always(prompt.Cancel),
+		events:       eventbus.New(nil),
 	}
 }
 
+// SetRevisionStore 设置本地修订历史仓库
+func (w *Workspace) SetRevisionStore(store *revision.Store) {
+	w.revisions = store
+}
+
+// Revisions 获取本地修订历史仓库
+func (w *Workspace) Revisions() *revision.Store {
+	return w.revisions
+}
+
+// SetLogResolver 设置日志路径策略（应与日志模块使用的一致）
+func (w *Workspace) SetLogResolver(resolver *logpath.Resolver) {
+	w.logs = resolver
+}
+
+// LogResolver 获取日志路径策略
+func (w *Workspace) LogResolver() *logpath.Resolver {
+	if w.logs == nil {
+		return logpath.Default()
+	}
+	return w.logs
+}
+
+// Lock 获取工作区锁（执行用户指令或后台检测前调用）
+func (w *Workspace) Lock() {
+	w.mu.Lock()
+}
+
+// Unlock 释放工作区锁
+func (w *Workspace) Unlock() {
+	w.mu.Unlock()
+}
+
 // ------------------------------
 // 观察者模式实现
 // ------------------------------
 
-// RegisterObserver 注册观察者
-func (w *Workspace) RegisterObserver(observer common.Observer) {
-	w.observers = append(w.observers, observer)
+// RegisterObserver 注册观察者（接收全部事件，队列满时等待），返回的订阅句柄用于取消订阅
+func (w *Workspace) RegisterObserver(observer common.Observer) *eventbus.Subscription {
+	return w.events.Subscribe(observer, eventbus.Options{})
 }
 
-// RemoveObserver 移除观察者
-func (w *Workspace) RemoveObserver(observer common.Observer) {
-	for i, obs := range w.observers {
-		if obs == observer {
-			// 从切片中移除
-			w.observers = append(w.observers[:i], w.observers[i+1:]...)
-			break
-		}
-	}
+// Subscribe 按指定的过滤条件、队列长度和队列满时的处理方式订阅事件
+// 观察者的 Update 中不能调用 Lock 或其他需要工作区锁的方法：指令执行期间持有锁时会等待观察者处理完已发出的事件
+// （如 Rename 迁移日志前调用 FlushEvents），观察者再等待该锁会造成死锁
+func (w *Workspace) Subscribe(observer common.Observer, opts eventbus.Options) *eventbus.Subscription {
+	return w.events.Subscribe(observer, opts)
 }
 
-// notifyObservers 通知所有观察者（公开，暴露给编辑器
+// NotifyObservers 通知所有观察者（公开，暴露给编辑器）：事件放入各观察者的队列后立即返回
+// 执行用户指令期间产生的事件标记为 Derived（调用方需持有工作区锁）
 func (w *Workspace) NotifyObservers(event common.WorkspaceEvent) {
-	for _, observer := range w.observers {
-		observer.Update(event)
+	if w.inCommand && event.Kind != common.EventCommandExecuted {
+		event.Derived = true
+	}
+	if event.FilePath != "" {
+		w.logged[event.FilePath] = true
+	}
+	w.events.Publish(event)
+}
+
+// BeginCommand 开始执行用户指令，此后产生的事件由该指令引起（调用方需持有工作区锁）
+func (w *Workspace) BeginCommand() {
+	w.inCommand = true
+}
+
+// EndCommand 用户指令执行完毕（在发布 CommandExecuted 事件之前调用）
+func (w *Workspace) EndCommand() {
+	w.inCommand = false
+}
+
+// FlushEvents 等待已发出的事件全部被观察者处理（如 log-show 读取日志前）；可能在持有工作区锁时调用，见 Subscribe
+func (w *Workspace) FlushEvents() {
+	w.events.Flush()
+}
+
+// notifyEditor 通知观察者文件相关的事件，事件中记录文件当前的日志开关
+func (w *Workspace) notifyEditor(editor common.Editor, kind common.EventKind, eventType, command string, payload common.EventPayload) {
+	w.NotifyObservers(common.WorkspaceEvent{
+		FilePath:   editor.GetFilePath(),
+		Kind:       kind,
+		Payload:    payload,
+		Type:       eventType,
+		Command:    command,
+		Timestamp:  time.Now().UnixMilli(),
+		LogEnabled: editor.IsLogEnabled(),
+	})
+}
+
+// CloseObservers 处理完所有已发出的事件后停止事件总线，再关闭持有文件等资源的观察者（实现了 io.Closer 的，如日志模块），退出前调用
+func (w *Workspace) CloseObservers() {
+	observers := w.events.Observers()
+	for name, n := range w.events.Close() {
+		fmt.Printf("警告：观察者 %s 因处理过慢丢弃了 %d 个事件\n", name, n)
+	}
+	for _, observer := range observers {
+		if closer, ok := observer.(io.Closer); ok {
+			if err := closer.Close(); err != nil {
+				fmt.Printf("警告：关闭 %T 失败: %v\n", observer, err)
+			}
+		}
 	}
 }
 
@@ -120,11 +264,8 @@ func (w *Workspace) NotifyObservers(event common.WorkspaceEvent) {
 // }
 
 func (w *Workspace) CreateMemento() *WorkspaceMemento {
-	// 收集已打开文件路径
-	openedPaths := make([]string, 0, len(w.OpenEditors))
-	for path := range w.OpenEditors {
-		openedPaths = append(openedPaths, path)
-	}
+	// 收集已打开文件路径（按打开顺序，恢复后 editor-list 顺序不变）
+	openedPaths := w.orderedPaths()
 
 	// 收集已修改文件路径
 	modifiedPaths := make([]string, 0)
@@ -135,12 +276,20 @@ func (w *Workspace) CreateMemento() *WorkspaceMemento {
 	}
 
 	// 新增：收集每个文件的日志状态
+	// 已修改的缓冲区按保存方式一并记录内容，从未保存的缓冲区单独标记
+	memento := &WorkspaceMemento{}
 	fileStates := make([]FileState, 0, len(w.OpenEditors))
 	for path, editor := range w.OpenEditors {
-		fileStates = append(fileStates, FileState{
+		state := FileState{
 			FilePath:   path,
 			LogEnabled: editor.IsLogEnabled(), // 获取每个文件的日志开关状态
-		})
+		}
+		state.NeverSaved = editor.IsNew()
+		if editor.IsModified() || state.NeverSaved {
+			w.saveBuffer(memento, len(fileStates), &state, editor)
+			state.MergeConflicts = editor.HasMergeConflicts()
+		}
+		fileStates = append(fileStates, state)
 	}
 
 	// 活动文件路径
@@ -149,17 +298,22 @@ func (w *Workspace) CreateMemento() *WorkspaceMemento {
 		activePath = w.activeEditor.GetFilePath()
 	}
 
-	return &WorkspaceMemento{
-		OpenedFilePaths:   openedPaths,
-		ActiveFilePath:    activePath,
-		ModifiedFilePaths: modifiedPaths,
-		FileStates:        fileStates, // 保存文件日志状态
-	}
+	memento.OpenedFilePaths = openedPaths
+	memento.ActiveFilePath = activePath
+	memento.ModifiedFilePaths = modifiedPaths
+	memento.FileStates = fileStates // 保存文件日志状态
+	// 路径统一为相对工作区的正斜杠写法，跨平台可恢复
+	w.toPortable(memento)
+	return memento
 }
 
 // SaveState 保存工作区状态到本地（持久化）
 func (w *Workspace) SaveState() error {
+	if w.StateLockedByOther() {
+		return errors.New("工作区状态正被另一个实例使用，未保存")
+	}
 	memento := w.CreateMemento()
+	w.WriteSidecars(memento)
 	data, err := json.MarshalIndent(memento, "", "  ")
 	if err != nil {
 		return err
@@ -168,61 +322,146 @@ func (w *Workspace) SaveState() error {
 	if err := os.MkdirAll(filepath.Dir(w.mementoPath), 0755); err != nil {
 		return err
 	}
-	return os.WriteFile(w.mementoPath, data, 0644)
+	if err := os.WriteFile(w.mementoPath, data, 0644); err != nil {
+		return err
+	}
+	w.PruneSidecars(memento)
+	return nil
 }
 
 // RestoreState 从本地恢复工作区状态
-func (w *Workspace) RestoreState(editorFactory func(path string, ws common.WorkSpaceApi) (common.Editor, error)) error {
+// 备忘录中记录了内容的缓冲区原样恢复：从未保存的通过 bufferFactory 在内存中创建，其余从磁盘加载后替换为记录的内容
+// 单个文件恢复失败不影响其他文件，失败原因汇总在返回的报告中；只有备忘录本身无法读取时才返回错误
+func (w *Workspace) RestoreState(editorFactory func(path string, ws common.WorkSpaceApi) (common.Editor, error),
+	bufferFactory func(path, content string, ws common.WorkSpaceApi) (common.Editor, error)) (*RestoreReport, error) {
+	report := &RestoreReport{display: w.DisplayName}
+
+	// 检测上次遗留的交换文件（root 目录及备忘录中各文件所在目录），等待 recover/discard
+	swapDirs := []string{w.root}
+	defer func() { w.detectSwapFiles(swapDirs) }()
+
 	// 读取备忘录文件
 	data, err := os.ReadFile(w.mementoPath)
 	if err != nil {
-		if os.IsNotExist(err) {
-			return err // 无状态文件，无需恢复
-		}
-		//return err
+		// 无状态文件（无需恢复）或无法读取
+		return report, err
 	}
 
-	var memento WorkspaceMemento
-	if err := json.Unmarshal(data, &memento); err != nil {
-		return err
+	// 解析并迁移到当前版本；损坏或版本过新而无法解析的状态文件改名保留，以新状态启动
+	memento, err := decodeMemento(data)
+	if err != nil {
+		corruptPath, moveErr := moveAsideCorrupt(w.mementoPath)
+		if moveErr != nil {
+			return report, fmt.Errorf("状态文件无法解析（%v），且无法移走: %w", err, moveErr)
+		}
+		fmt.Printf("警告：状态文件无法解析（%v），已移至 %s\n", err, corruptPath)
+		return report, fmt.Errorf("状态文件无法解析: %w", err)
 	}
+	w.fromPortable(memento)
 
 	// 恢复日志开关
 	//w.isLogEnabled = memento.IsLogEnabled
 
-	// 恢复已打开文件（通过编辑器工厂创建对应类型的编辑器）
 	for _, path := range memento.OpenedFilePaths {
-		editor, err := editorFactory(path, w)
+		swapDirs = append(swapDirs, filepath.Dir(path))
+	}
+
+	stateMap := make(map[string]FileState)
+	for _, state := range memento.FileStates {
+		stateMap[state.FilePath] = state
+	}
+
+	// 恢复已打开文件（通过编辑器工厂创建对应类型的编辑器），逐个记录失败原因
+	report.Total = len(memento.OpenedFilePaths)
+	restoredBuffers := make(map[string]bool)
+	for _, path := range memento.OpenedFilePaths {
+		editor, fromBuffer, err := w.restoreEditor(path, stateMap[path], editorFactory, bufferFactory)
 		if err != nil {
-			return err
+			report.addFailure(path, err)
+			continue
 		}
+		report.Restored = append(report.Restored, path)
+		restoredBuffers[path] = fromBuffer
 		w.OpenEditors[path] = editor
+		w.refreshDiskStamp(editor)
+		w.lockEditor(editor)
 	}
 
-	// 恢复修改状态
+	// 恢复修改状态：按记录内容恢复的缓冲区由内容版本决定，未记录内容的仍标记为已修改
 	for _, path := range memento.ModifiedFilePaths {
-		if editor, ok := w.OpenEditors[path]; ok {
+		if editor, ok := w.OpenEditors[path]; ok && !restoredBuffers[path] {
 			editor.MarkAsModified(true)
 		}
 	}
-	//恢复日志状态
-	logStateMap := make(map[string]bool)
+	// 日志状态以文件首行的 # log 标记为准，恢复时不修改文件内容；与备忘录记录不一致时仅提示
 	for _, state := range memento.FileStates {
-		logStateMap[state.FilePath] = state.LogEnabled
+		editor, ok := w.OpenEditors[state.FilePath]
+		if !ok || restoredBuffers[state.FilePath] || editor.IsLogEnabled() == state.LogEnabled {
+			continue
+		}
+		fmt.Printf("提示：%s 的日志状态以文件首行为准（当前%s），可使用 log-on / log-off 修改\n",
+			w.DisplayName(state.FilePath), map[bool]string{true: "已开启", false: "已关闭"}[editor.IsLogEnabled()])
 	}
-	for path, editor := range w.OpenEditors {
-		if logEnabled, ok := logStateMap[path]; ok {
-			editor.SetLogEnabled(logEnabled) // 应用保存的日志状态
+
+	// 恢复活动文件；原活动文件未能恢复时，改用第一个成功恢复的文件
+	for _, path := range report.Restored {
+		w.setActive(w.OpenEditors[path], false)
+	}
+	if editor, ok := w.OpenEditors[memento.ActiveFilePath]; ok {
+		w.setActive(editor, false)
+	} else if len(report.Restored) > 0 {
+		w.setActive(w.OpenEditors[report.Restored[0]], false)
+		if memento.ActiveFilePath != "" {
+			report.ActiveFallback = report.Restored[0]
+		}
+	}
+	return report, nil
+}
+
+// restoreEditor 恢复单个编辑器，备忘录中记录了缓冲区内容时原样恢复（第二个返回值表示是否按记录的内容恢复）
+func (w *Workspace) restoreEditor(path string, state FileState,
+	editorFactory func(path string, ws common.WorkSpaceApi) (common.Editor, error),
+	bufferFactory func(path, content string, ws common.WorkSpaceApi) (common.Editor, error)) (common.Editor, bool, error) {
+	content, base, ok, err := loadBuffer(state)
+	if err != nil {
+		fmt.Printf("警告：读取缓冲区 %s 的内容失败，改为从磁盘加载: %v\n", w.DisplayName(path), err)
+	}
+	_, statErr := os.Stat(path)
+	if !ok {
+		// 没有记录内容时只恢复磁盘上仍存在的文件，不为已删除的文件创建空文件
+		if statErr != nil {
+			return nil, false, statErr
 		}
+		editor, err := editorFactory(path, w)
+		return editor, false, err
 	}
 
-	// 恢复活动文件
-	if memento.ActiveFilePath != "" {
-		if editor, ok := w.OpenEditors[memento.ActiveFilePath]; ok {
-			w.activeEditor = editor
+	// 从未保存（或磁盘上已被删除）的缓冲区：只在内存中创建，不触碰磁盘（日志开关以内容首行为准）
+	if os.IsNotExist(statErr) {
+		editor, err := bufferFactory(path, content, w)
+		if err != nil {
+			return nil, false, err
 		}
+		editor.MarkAsModified(true)
+		editor.SetMergeConflicts(state.MergeConflicts)
+		return editor, true, nil
 	}
-	return nil
+
+	// 已修改的缓冲区：从磁盘加载后替换为记录的内容（可撤销回磁盘内容，日志开关随内容首行），基准恢复为上次会话的磁盘内容
+	editor, err := editorFactory(path, w)
+	if err != nil {
+		return nil, false, err
+	}
+	if content != editor.GetContent() {
+		if err := editor.SetContent(content); err != nil {
+			return nil, false, err
+		}
+	}
+	if state.BufferBase != nil || state.BufferFile != "" {
+		editor.SetBaseContent(base)
+	}
+	editor.SetMergeConflicts(state.MergeConflicts)
+	return editor, true, nil
 }
 
 // ------------------------------
@@ -237,39 +476,68 @@ func (w *Workspace) RestoreState(editorFactory func(path string, ws common.WorkS
 
 // 功能：1. 拼接路径为 ./files/文件名 2. 检查文件是否已打开 3. 通过工厂创建编辑器 4. 加入工作区并设为激活
 func (w *Workspace) LoadFile(path string, editorFactory func(path string, w common.WorkSpaceApi) (common.Editor, error)) (common.Editor, error) {
-	// 1. 标准化路径：使用 filepath 包拼接，保证跨平台兼容性（Linux/macOS /, Windows \）
-	// 仅拼接一次 ./files 目录，解决路径重复问题
-	fullPath := filepath.Join("./files", path)
+	// 1. 将用户输入转换为规范路径（相对路径相对于 root 目录）
+	fullPath, err := w.ResolvePath(path)
+	if err != nil {
+		return nil, err
+	}
+	return w.openPath(fullPath, editorFactory)
+}
 
+// openPath 打开（或切换到）指定完整路径的文件
+func (w *Workspace) openPath(fullPath string, editorFactory func(path string, w common.WorkSpaceApi) (common.Editor, error)) (common.Editor, error) {
 	// 2. 检查文件是否已在工作区中打开
 	if editor, ok := w.OpenEditors[fullPath]; ok {
 		w.SetActiveEditor(editor)
 		return editor, nil
 	}
 
-	// 3. 确保 ./files 目录存在（首次加载文件时创建，避免文件写入失败）
-	if err := os.MkdirAll("./files", 0755); err != nil {
-		return nil, errors.New("创建 files 目录失败: " + err.Error())
-	}
-
-	// 4. 通过工厂方法创建对应类型的编辑器（文本/XML）
-	// 工厂方法接收的是完整路径 fullPath，可处理「当前目录下非工作区文件」的查找逻辑
+	// 3. 通过工厂方法创建对应类型的编辑器（文本/XML）
+	// 工厂方法接收的是完整路径 fullPath；文件不存在时只在内存中创建新缓冲区，不写入磁盘
 	editor, err := editorFactory(fullPath, w)
 	if err != nil {
 		return nil, errors.New("创建编辑器失败: " + err.Error())
 	}
 
-	// 5. 将新编辑器添加到工作区并设为激活
+	// 4. 将新编辑器添加到工作区并设为激活，记录磁盘快照用于检测外部修改
 	w.OpenEditors[fullPath] = editor
+	w.refreshDiskStamp(editor)
+	w.lockEditor(editor)
+	w.notifyEditor(editor, common.EventFileLoaded, "Load", "Load "+fullPath,
+		common.FilePayload{Version: editor.Version(), New: editor.IsNew()})
 	w.SetActiveEditor(editor)
+	if !editor.IsNew() {
+		w.touchRecent(fullPath)
+	}
 
-	// 可选：通知观察者文件已加载（取消注释启用）
-	// w.notifyObservers(common.WorkspaceEvent{
-	// 	Type:      "FILE_LOADED",
-	// 	Data:      map[string]string{"path": fullPath},
-	// 	Timestamp: time.Now().UnixMilli(),
-	// })
+	return editor, nil
+}
 
+// NewBuffer 创建只在内存中的新缓冲区并设为活动文件（init），save 时才写入磁盘
+// 路径上已有文件时拒绝创建（新缓冲区没有磁盘基准，保存时无法与已有内容正确合并），应使用 load 打开
+func (w *Workspace) NewBuffer(path, content string,
+	bufferFactory func(path, content string, ws common.WorkSpaceApi) (common.Editor, error)) (common.Editor, error) {
+	fullPath, err := w.ResolvePath(path)
+	if err != nil {
+		return nil, err
+	}
+	if _, ok := w.OpenEditors[fullPath]; ok {
+		return nil, errors.New("文件已打开: " + w.DisplayName(fullPath))
+	}
+	if _, err := os.Lstat(fullPath); err == nil {
+		return nil, errors.New("文件已存在，请使用 load 打开: " + w.DisplayName(fullPath))
+	} else if !os.IsNotExist(err) {
+		return nil, err
+	}
+	editor, err := bufferFactory(fullPath, content, w)
+	if err != nil {
+		return nil, errors.New("创建编辑器失败: " + err.Error())
+	}
+	w.OpenEditors[fullPath] = editor
+	w.refreshDiskStamp(editor)
+	w.notifyEditor(editor, common.EventFileLoaded, "Init", "Init "+fullPath,
+		common.FilePayload{Version: editor.Version(), New: true})
+	w.SetActiveEditor(editor)
 	return editor, nil
 }
 
@@ -287,74 +555,134 @@ func (w *Workspace) SaveFile(editor common.Editor) error {
 		return errors.New("file path is empty: 编辑器文件路径为空")
 	}
 
+	// 文件被其他实例锁定时不允许覆盖
+	if editor.IsReadOnly() {
+		return errors.New("文件正被另一个实例编辑，当前以只读方式打开，无法保存")
+	}
+
 	// 3. 确保文件所在目录存在（防止目录被手动删除后保存失败）
 	dir := filepath.Dir(path)
 	if err := os.MkdirAll(dir, 0755); err != nil {
 		return errors.New("创建文件目录失败: " + err.Error())
 	}
 
-	// 4. 从编辑器中获取内容并写入文件
+	// 4. 本工作区合并插入的冲突标记尚未解决时拒绝保存（文件本身含有类似标记的行不受影响）
 	content := editor.GetContent()
-	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+	if editor.HasMergeConflicts() {
+		if n := len(textdiff.FindConflicts(textdiff.SplitLines(content))); n > 0 {
+			return fmt.Errorf("仍有 %d 处冲突未解决，请使用 conflicts / resolve 处理后再保存", n)
+		}
+		editor.SetMergeConflicts(false)
+	}
+
+	// 5. 磁盘内容自加载后被其他程序修改过：以加载时内容为基准做三方合并
+	merged, err := w.mergeWithDisk(editor)
+	if err != nil {
+		return err
+	}
+	if merged {
+		content = editor.GetContent()
+	}
+
+	// 6. 从编辑器中获取内容，备份旧文件后原子地写入（保留原权限）
+	if err := w.writeFile(path, []byte(content)); err != nil {
 		return errors.New("写入文件内容失败: " + err.Error())
 	}
 
-	// 5. 清除编辑器的修改标记
+	// 7. 清除编辑器的修改标记，并记录新的合并基准；新缓冲区首次写入磁盘后加锁
+	if editor.IsNew() {
+		editor.SetNew(false)
+		w.lockEditor(editor)
+		w.touchRecent(path)
+	}
 	editor.MarkAsModified(false)
-
-	// 6. 若开启日志，通知观察者保存事件
-	if editor.IsLogEnabled() {
-		w.NotifyObservers(common.WorkspaceEvent{
-			FilePath:  path,
-			Type:      "Save",
-			Command:   "Save " + path,
-			Timestamp: time.Now().UnixMilli(),
-		})
+	editor.SetBaseContent(content)
+	w.refreshDiskStamp(editor)
+	w.removeSwapFile(path)
+
+	// 记录本地修订历史（失败仅提示，不影响保存结果）
+	if w.revisions != nil {
+		if _, err := w.revisions.Save(w.DisplayName(path), []byte(content)); err != nil {
+			fmt.Printf("警告：记录修订历史失败: %v\n", err)
+		}
 	}
 
+	// 8. 若开启日志，通知观察者保存事件
+	w.notifyEditor(editor, common.EventSaved, "Save", "Save "+path, common.FilePayload{Version: editor.Version()})
+
 	return nil
 }
 
+// mergeWithDisk 检查磁盘内容是否偏离加载时的基准，若偏离则与缓冲区三方合并
+// 返回值表示缓冲区是否已被合并结果替换；存在冲突时返回错误，冲突标记已写入缓冲区
+func (w *Workspace) mergeWithDisk(editor common.Editor) (bool, error) {
+	diskData, err := os.ReadFile(editor.GetFilePath())
+	if err != nil {
+		if os.IsNotExist(err) {
+			return false, nil // 磁盘上没有该文件，直接写入即可
+		}
+		return false, errors.New("读取磁盘内容失败: " + err.Error())
+	}
+
+	disk := string(diskData)
+	base := editor.GetBaseContent()
+	content := editor.GetContent()
+	if disk == base || disk == content {
+		return false, nil
+	}
+
+	result := textdiff.Merge3(textdiff.SplitLines(base), textdiff.SplitLines(content), textdiff.SplitLines(disk))
+	if err := editor.SetContent(strings.Join(result.Lines, "\n")); err != nil {
+		return false, err
+	}
+	// 磁盘上的修改已并入缓冲区，之后以磁盘内容作为新的基准
+	editor.SetBaseContent(disk)
+
+	if result.Conflicts > 0 {
+		editor.SetMergeConflicts(true)
+		return true, fmt.Errorf("文件在磁盘上已被修改，合并出现 %d 处冲突，已插入冲突标记，请使用 conflicts / resolve 处理后再保存", result.Conflicts)
+	}
+	fmt.Printf("文件 %s 在磁盘上已被修改，已自动合并\n", w.DisplayName(editor.GetFilePath()))
+	return true, nil
+}
+
 // CloseFile 关闭文件
 func (w *Workspace) CloseFile(path string) error {
 
-	if path == "" {
-		return errors.New("file path is empty: 文件路径不能为空")
+	fullPath, err := w.ResolvePath(path)
+	if err != nil {
+		return err
 	}
 
-	fullPath := filepath.Join("./files", path)
-
 	if _, ok := w.OpenEditors[fullPath]; !ok {
-		return errors.New("file not open: 文件未打开（查找路径：" + fullPath + "）")
+		return errors.New("file not open: 文件未打开（查找路径：" + w.DisplayName(fullPath) + "）")
 	}
 
 	editor := w.OpenEditors[fullPath]
 
-	if editor.IsLogEnabled() {
-		w.NotifyObservers(common.WorkspaceEvent{
-			FilePath:  editor.GetFilePath(),
-			Type:      "Close",
-			Command:   "Close " + editor.GetFilePath(),
-			Timestamp: time.Now().UnixMilli(),
-		})
+	// 已修改的文件先询问是否保存（取消时不关闭）
+	if err := w.confirmDirty(editor); err != nil {
+		return err
 	}
 
+	w.notifyEditor(editor, common.EventFileClosed, "Close", "Close "+fullPath,
+		common.FilePayload{Version: editor.Version(), New: editor.IsNew()})
+
+	w.removeEditor(fullPath)
+	return nil
+}
+
+// removeEditor 从工作区移除编辑器，释放其交换文件和锁；移除的是活动编辑器时另选一个
+func (w *Workspace) removeEditor(fullPath string) {
 	delete(w.OpenEditors, fullPath)
+	w.removeSwapFile(fullPath)
+	w.unlockEditor(fullPath)
+	w.forgetEditor(fullPath)
 
 	if w.activeEditor != nil && w.activeEditor.GetFilePath() == fullPath {
-		// 7.1 若还有其他打开的文件，取第一个作为新的激活文件
-		if len(w.OpenEditors) > 0 {
-			for _, ed := range w.OpenEditors {
-				w.activeEditor = ed
-				break
-			}
-		} else {
-
-			w.activeEditor = nil
-		}
+		// 7.1 若还有其他打开的文件，取最近使用的一个作为新的激活文件
+		w.activate(w.mostRecentEditor(), false)
 	}
-
-	return nil
 }
 
 // SetActiveEditor 设置当前活动编辑器
@@ -371,7 +699,7 @@ func (w *Workspace) SetActiveEditor(editor common.Editor) {
 	if _, ok := w.OpenEditors[path]; !ok {
 		return
 	}
-	w.activeEditor = editor
+	w.activate(editor, true)
 }
 
 // // ToggleLog 切换日志开关状态
@@ -384,11 +712,11 @@ func (w *Workspace) GetActiveEditor() common.Editor {
 	return w.activeEditor
 }
 
-// GetOpenEditors 获取所有已打开的编辑器
+// GetOpenEditors 获取所有已打开的编辑器（按打开顺序）
 func (w *Workspace) GetOpenEditors() []common.Editor {
 	editors := make([]common.Editor, 0, len(w.OpenEditors))
-	for _, editor := range w.OpenEditors {
-		editors = append(editors, editor)
+	for _, path := range w.orderedPaths() {
+		editors = append(editors, w.OpenEditors[path])
 	}
 
 	return editors